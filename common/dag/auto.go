@@ -0,0 +1,75 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"runtime"
+	"time"
+)
+
+// CPUClock return the cpu time consumed by the process so far, e.g. user+system time from getrusage
+type CPUClock func() time.Duration
+
+// thresholds of the concurrency heuristic
+const (
+	ioBoundUtilization  = 0.5
+	cpuBoundUtilization = 0.9
+	maxWorkersPerProc   = 16
+)
+
+// NewAutoDispatcher create a dispatcher with one worker per GOMAXPROCS and no timeout
+func NewAutoDispatcher(dag *Dag, cb Callback) *Dispatcher {
+	return NewDispatcher(dag, runtime.GOMAXPROCS(0), 0, nil, cb)
+}
+
+// SetCPUClock set the cpu time source, Run reports the worker utilization in Result when set
+func (dp *Dispatcher) SetCPUClock(clock CPUClock) {
+	dp.cpuClock = clock
+}
+
+// utilization return the share of the workers' wall time spent on cpu
+func utilization(cpu, wall time.Duration, workers int) float64 {
+	if wall <= 0 || workers <= 0 {
+		return 0
+	}
+	return float64(cpu) / (float64(wall) * float64(workers))
+}
+
+// SuggestConcurrency suggest the concurrency of the next run from the utilization of the last one.
+// Workers mostly waiting on I/O (utilization < 0.5) are doubled, up to 16 per GOMAXPROCS,
+// workers saturating the cpu (utilization > 0.9) are cut down to GOMAXPROCS,
+// otherwise or if the utilization is unknown the current concurrency is kept.
+func SuggestConcurrency(current int, utilization float64) int {
+	procs := runtime.GOMAXPROCS(0)
+	if current <= 0 {
+		return procs
+	}
+	switch {
+	case utilization <= 0:
+		return current
+	case utilization < ioBoundUtilization:
+		if current*2 > procs*maxWorkersPerProc {
+			return procs * maxWorkersPerProc
+		}
+		return current * 2
+	case utilization > cpuBoundUtilization && current > procs:
+		return procs
+	}
+	return current
+}
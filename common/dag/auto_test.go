@@ -0,0 +1,67 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAutoDispatcher(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dp := NewAutoDispatcher(dag, func(node *Node, context interface{}) error {
+		return nil
+	})
+	assert.Equal(t, runtime.GOMAXPROCS(0), dp.concurrency)
+	assert.Nil(t, dp.Run())
+}
+
+func TestSuggestConcurrency(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	assert.Equal(t, procs, SuggestConcurrency(0, 0.1))
+	assert.Equal(t, 4, SuggestConcurrency(4, 0))
+	assert.Equal(t, 4, SuggestConcurrency(4, 0.7))
+	assert.Equal(t, 2*procs, SuggestConcurrency(procs, 0.1))
+	assert.Equal(t, 16*procs, SuggestConcurrency(16*procs, 0.1))
+	assert.Equal(t, procs, SuggestConcurrency(8*procs, 0.95))
+	assert.Equal(t, 1, SuggestConcurrency(1, 0.95))
+}
+
+func TestDispatcher_Utilization(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	cpu := time.Duration(0)
+	dp.SetCPUClock(func() time.Duration {
+		cpu += time.Millisecond
+		return cpu
+	})
+	result := dp.RunSummary()
+	assert.Nil(t, result.Err)
+	assert.True(t, result.Utilization > 0 && result.Utilization < ioBoundUtilization)
+	assert.Equal(t, 2, SuggestConcurrency(1, result.Utilization))
+	assert.Equal(t, 0.0, NewDispatcher(dag, 1, 0, nil, dp.cb).RunSummary().Utilization)
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"sync"
+)
+
+// DagBuilder is a concurrency-safe builder of Dag,
+// Build produces a snapshot which is never mutated by the builder again
+type DagBuilder struct {
+	mu  sync.Mutex
+	dag *Dag
+}
+
+// NewDagBuilder new dag builder
+func NewDagBuilder() *DagBuilder {
+	return &DagBuilder{
+		dag: NewDag(),
+	}
+}
+
+// AddNode add node
+func (b *DagBuilder) AddNode(key interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dag.AddNode(key)
+}
+
+// AddEdge add edge fromKey toKey
+func (b *DagBuilder) AddEdge(fromKey, toKey interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dag.AddEdge(fromKey, toKey)
+}
+
+// AddNodes add the nodes as one batch, see Dag.AddNodes
+func (b *DagBuilder) AddNodes(nodes []NodeSpec) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dag.AddNodes(nodes)
+}
+
+// AddEdges add the edges as one batch, see Dag.AddEdges
+func (b *DagBuilder) AddEdges(edges []Edge) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dag.AddEdges(edges)
+}
+
+// Len return the number of nodes added so far
+func (b *DagBuilder) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.dag.Len()
+}
+
+// Build return a finalized snapshot of the dag built so far,
+// it's safe for the dispatcher to read without locks
+func (b *DagBuilder) Build() *Dag {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dag := b.dag.clone()
+	dag.Finalize()
+	return dag
+}
@@ -0,0 +1,63 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDagBuilder_Build(t *testing.T) {
+	builder := NewDagBuilder()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			builder.AddNode(strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 100, builder.Len())
+
+	for i := 1; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			builder.AddEdge(strconv.Itoa(i-1), strconv.Itoa(i))
+		}(i)
+	}
+	wg.Wait()
+
+	dag := builder.Build()
+	assert.Equal(t, 100, dag.Len())
+	assert.Equal(t, 1, len(dag.GetRootNodes()))
+	assert.Equal(t, false, dag.IsCirclular())
+
+	// the snapshot is not affected by further building
+	builder.AddNode("100")
+	builder.AddEdge("99", "100")
+	assert.Equal(t, 100, dag.Len())
+	assert.Equal(t, 0, len(dag.GetChildrenNodes("99")))
+	assert.Equal(t, 1, len(builder.Build().GetChildrenNodes("99")))
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// NodeSpec describe a node added by AddNodes
+type NodeSpec struct {
+	Key            interface{}
+	Labels         map[string]string
+	ExclusionGroup string
+}
+
+// BatchError lists every problem of a rejected batch, Errs[i] is the problem of Items[i],
+// a NodeSpec or an Edge. Nothing of the batch is applied.
+type BatchError struct {
+	Items []interface{}
+	Errs  []error
+}
+
+func (e *BatchError) add(item interface{}, err error) {
+	e.Items = append(e.Items, item)
+	e.Errs = append(e.Errs, err)
+}
+
+func (e *BatchError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%d problems in batch", len(e.Errs)))
+	for i, err := range e.Errs {
+		buf.WriteString(fmt.Sprintf("; %+v: %s", e.Items[i], err))
+	}
+	return buf.String()
+}
+
+// AddNodes add the nodes in order if none of their keys is already in the dag or repeated
+// in the batch, otherwise nothing is added and a *BatchError lists the duplicates
+func (dag *Dag) AddNodes(nodes []NodeSpec) error {
+	batchErr := &BatchError{}
+	seen := make(map[interface{}]bool, len(nodes))
+	for _, spec := range nodes {
+		key := dag.keyOf(spec.Key)
+		if _, ok := dag.nodes[key]; ok || seen[key] {
+			batchErr.add(spec, ErrKeyIsExisted)
+		}
+		seen[key] = true
+	}
+	if len(batchErr.Errs) > 0 {
+		return batchErr
+	}
+
+	for _, spec := range nodes {
+		dag.AddNode(spec.Key)
+		node := dag.nodes[dag.keyOf(spec.Key)]
+		for k, v := range spec.Labels {
+			node.SetLabel(k, v)
+		}
+		node.SetExclusionGroup(spec.ExclusionGroup)
+	}
+	return nil
+}
+
+// AddEdges add the edges in order if all of them are valid, otherwise nothing is added and
+// a *BatchError lists the edges with an unknown endpoint, the self loops and the edges
+// already in the dag or repeated in the batch
+func (dag *Dag) AddEdges(edges []Edge) error {
+	batchErr := &BatchError{}
+	seen := make(map[Edge]bool, len(edges))
+	for _, edge := range edges {
+		from, fromOk := dag.nodes[dag.keyOf(edge.From)]
+		to, toOk := dag.nodes[dag.keyOf(edge.To)]
+		switch {
+		case !fromOk || !toOk:
+			batchErr.add(edge, ErrKeyNotFound)
+			continue
+		case from == to:
+			batchErr.add(edge, ErrSelfLoop)
+			continue
+		}
+		key := Edge{From: from.key, To: to.key}
+		if seen[key] {
+			batchErr.add(edge, ErrKeyIsExisted)
+			continue
+		}
+		seen[key] = true
+		for _, child := range from.children {
+			if child == to {
+				batchErr.add(edge, ErrKeyIsExisted)
+				break
+			}
+		}
+	}
+	if len(batchErr.Errs) > 0 {
+		return batchErr
+	}
+
+	for _, edge := range edges {
+		dag.AddEdge(edge.From, edge.To)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDag_AddNodesEdges(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("a")
+
+	err := dag.AddNodes([]NodeSpec{{Key: "b"}, {Key: "a"}, {Key: "c"}, {Key: "b"}})
+	batchErr, ok := err.(*BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, []error{ErrKeyIsExisted, ErrKeyIsExisted}, batchErr.Errs)
+	assert.Equal(t, []interface{}{NodeSpec{Key: "a"}, NodeSpec{Key: "b"}}, batchErr.Items)
+	assert.Equal(t, 1, dag.Len())
+
+	assert.Nil(t, dag.AddNodes([]NodeSpec{
+		{Key: "b", Labels: map[string]string{"kind": "transfer"}},
+		{Key: "c", ExclusionGroup: "acc1"},
+		{Key: "d", ExclusionGroup: "acc1"},
+	}))
+	assert.Equal(t, 4, dag.Len())
+	assert.Equal(t, 3, dag.GetNode("d").Index())
+	kind, _ := dag.GetNode("b").Label("kind")
+	assert.Equal(t, "transfer", kind)
+	assert.Equal(t, "acc1", dag.GetNode("c").ExclusionGroup())
+
+	dag.AddEdge("a", "b")
+	err = dag.AddEdges([]Edge{
+		{From: "a", To: "c"},
+		{From: "a", To: "x"},
+		{From: "c", To: "c"},
+		{From: "a", To: "b"},
+		{From: "b", To: "d"},
+		{From: "b", To: "d"},
+	})
+	batchErr, ok = err.(*BatchError)
+	assert.True(t, ok)
+	assert.Equal(t, []error{ErrKeyNotFound, ErrSelfLoop, ErrKeyIsExisted, ErrKeyIsExisted}, batchErr.Errs)
+	assert.Equal(t, []interface{}{Edge{"a", "x"}, Edge{"c", "c"}, Edge{"a", "b"}, Edge{"b", "d"}}, batchErr.Items)
+	assert.Contains(t, err.Error(), "4 problems in batch")
+	assert.Equal(t, 1, len(dag.GetNode("a").Children()))
+
+	assert.Nil(t, dag.AddEdges([]Edge{{From: "a", To: "c"}, {From: "b", To: "d"}, {From: "c", To: "d"}}))
+	assert.Equal(t, 2, len(dag.GetNode("a").Children()))
+	assert.Equal(t, 2, dag.GetNode("d").parentCounter)
+
+	// the builder applies batches under its lock
+	builder := NewDagBuilder()
+	assert.Nil(t, builder.AddNodes([]NodeSpec{{Key: 1}, {Key: 2}}))
+	assert.Nil(t, builder.AddEdges([]Edge{{From: 1, To: 2}}))
+	assert.NotNil(t, builder.AddEdges([]Edge{{From: 2, To: 3}}))
+	assert.Equal(t, 1, builder.Build().GetNode(2).parentCounter)
+}
@@ -0,0 +1,223 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// key kinds of the compact encoding
+const (
+	compactIndexKey = iota
+	compactIntKey
+	compactStringKey
+	compactInternedKey
+
+	compactKindBits = 2
+)
+
+// Errors
+var (
+	ErrUnsupportedCompactKey = errors.New("key is not an int, string or interned key, it can't be encoded compactly")
+)
+
+// MarshalCompact encode the dag in a compact binary form for the network.
+// Nodes are written once in index order, each as the gap to the previous index
+// and the kind of its key followed by the key, an int key equal to the index is
+// not written again. Edges are pairs of node positions grouped by parent, the
+// parent as the delta to the previous one and the child as the delta to its parent.
+// Only int, string and interned keys can be encoded, ErrUnsupportedCompactKey is returned
+// for other keys. The KeyFunc isn't encoded, see UnmarshalCompactDagWithKeyFunc.
+func (dag *Dag) MarshalCompact() ([]byte, error) {
+	indexs := make([]int, 0, len(dag.indexs))
+	for idx := range dag.indexs {
+		indexs = append(indexs, idx)
+	}
+	sort.Ints(indexs)
+
+	buf := make([]byte, 0, 4*len(indexs))
+	var scratch [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		buf = append(buf, scratch[:binary.PutUvarint(scratch[:], v)]...)
+	}
+	putVarint := func(v int64) {
+		buf = append(buf, scratch[:binary.PutVarint(scratch[:], v)]...)
+	}
+
+	positions := make(map[*Node]uint64, len(indexs))
+	edges := 0
+	putUvarint(uint64(len(indexs)))
+	prev := -1
+	for i, idx := range indexs {
+		node := dag.nodes[dag.indexs[idx]]
+		positions[node] = uint64(i)
+		edges += len(node.children)
+
+		gap := uint64(idx-prev-1) << compactKindBits
+		prev = idx
+		switch key := node.key.(type) {
+		case int:
+			if key == idx {
+				putUvarint(gap | compactIndexKey)
+				break
+			}
+			putUvarint(gap | compactIntKey)
+			putVarint(int64(key))
+		case string:
+			putUvarint(gap | compactStringKey)
+			putUvarint(uint64(len(key)))
+			buf = append(buf, key...)
+		case internedKey:
+			putUvarint(gap | compactInternedKey)
+			putUvarint(uint64(len(key)))
+			buf = append(buf, key...)
+		default:
+			return nil, ErrUnsupportedCompactKey
+		}
+	}
+
+	putUvarint(uint64(edges))
+	var from uint64
+	for _, idx := range indexs {
+		node := dag.nodes[dag.indexs[idx]]
+		for _, child := range node.children {
+			putUvarint(positions[node] - from)
+			from = positions[node]
+			putVarint(int64(positions[child]) - int64(from))
+		}
+	}
+	return buf, nil
+}
+
+// compactReader read the varints of a compact encoding
+type compactReader struct {
+	buf []byte
+	err error
+}
+
+func (r *compactReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = ErrInvalidCompactDag
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *compactReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = ErrInvalidCompactDag
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *compactReader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = ErrInvalidCompactDag
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// UnmarshalCompactDag decode a dag encoded by MarshalCompact
+func UnmarshalCompactDag(data []byte) (*Dag, error) {
+	return UnmarshalCompactDagWithKeyFunc(data, nil)
+}
+
+// UnmarshalCompactDagWithKeyFunc decode a dag encoded by MarshalCompact
+// into a dag using keyFunc, pass the KeyFunc of the encoded dag
+func UnmarshalCompactDagWithKeyFunc(data []byte, keyFunc KeyFunc) (*Dag, error) {
+	r := &compactReader{buf: data}
+	dag := NewDagWithKeyFunc(keyFunc)
+
+	count := r.uvarint()
+	if count > uint64(len(data)) {
+		return nil, ErrInvalidCompactDag
+	}
+	keys := make([]interface{}, 0, count)
+	index := -1
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		header := r.uvarint()
+		index += int(header>>compactKindBits) + 1
+
+		var key interface{}
+		switch header & (1<<compactKindBits - 1) {
+		case compactIndexKey:
+			key = index
+		case compactIntKey:
+			key = int(r.varint())
+		case compactStringKey:
+			key = string(r.bytes(r.uvarint()))
+		case compactInternedKey:
+			key = internedKey(r.bytes(r.uvarint()))
+		}
+		if r.err != nil {
+			break
+		}
+		key = dag.keyOf(key)
+
+		if _, ok := dag.nodes[key]; ok {
+			return nil, ErrKeyIsExisted
+		}
+		dag.nodes[key] = NewNode(key, index)
+		dag.indexs[index] = key
+		dag.index = index + 1
+		keys = append(keys, key)
+	}
+
+	edges := r.uvarint()
+	var from uint64
+	for i := uint64(0); i < edges && r.err == nil; i++ {
+		from += r.uvarint()
+		to := int64(from) + r.varint()
+		if r.err != nil {
+			break
+		}
+		if from >= uint64(len(keys)) || to < 0 || to >= int64(len(keys)) {
+			return nil, ErrInvalidCompactDag
+		}
+		if err := dag.AddEdge(keys[from], keys[to]); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.buf) > 0 {
+		return nil, ErrInvalidCompactDag
+	}
+	return dag, nil
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDag_MarshalCompact(t *testing.T) {
+	dag1 := NewDag()
+	dag1.AddNode("key1")
+	dag1.AddNode(2)
+	dag1.AddNode(-3)
+	dag1.AddNode("")
+	dag1.AddEdge("key1", 2)
+	dag1.AddEdge("key1", -3)
+	dag1.AddEdge(2, "")
+	dag1.AddEdge(-3, "")
+
+	dag2, err := UnmarshalCompactDag(mustMarshalCompact(t, dag1))
+	assert.Nil(t, err)
+	assert.True(t, dag1.Equal(dag2))
+	assert.Equal(t, mustMarshalCompact(t, dag1), mustMarshalCompact(t, dag2))
+	assert.Nil(t, dag2.AddNode("key5"))
+	assert.Equal(t, 4, dag2.GetNode("key5").Index())
+
+	empty, err := UnmarshalCompactDag(mustMarshalCompact(t, NewDag()))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, empty.Len())
+
+	interned := NewDagWithKeyFunc(InternHexKey)
+	interned.AddNode("0a0b")
+	interned.AddNode("0c0d")
+	interned.AddEdge("0a0b", "0c0d")
+	dag3, err := UnmarshalCompactDagWithKeyFunc(mustMarshalCompact(t, interned), InternHexKey)
+	assert.Nil(t, err)
+	assert.True(t, interned.Equal(dag3))
+	// the key func comes back, the keys can still be given in hex
+	assert.Equal(t, 1, dag3.GetNode("0c0d").Index())
+	assert.Nil(t, dag3.AddNode("0e0f"))
+	assert.Equal(t, ErrKeyIsExisted, dag3.AddNode([]byte{0x0a, 0x0b}))
+
+	// keys of other kinds are rejected instead of being changed
+	for _, key := range []interface{}{int64(1), uint8(2), 1.5, true} {
+		other := NewDag()
+		other.AddNode(key)
+		_, err := other.MarshalCompact()
+		assert.Equal(t, ErrUnsupportedCompactKey, err)
+	}
+	byKey := NewDagWithKeyFunc(func(key interface{}) interface{} {
+		if k, ok := key.(int64); ok {
+			return int(k)
+		}
+		return key
+	})
+	byKey.AddNode(int64(7))
+	byKey.AddNode("x")
+	byKey.AddEdge(int64(7), "x")
+	dag4, err := UnmarshalCompactDagWithKeyFunc(mustMarshalCompact(t, byKey), byKey.keyFunc)
+	assert.Nil(t, err)
+	assert.True(t, byKey.Equal(dag4))
+	assert.NotNil(t, dag4.GetNode(int64(7)))
+}
+
+func mustMarshalCompact(t *testing.T, dag *Dag) []byte {
+	data, err := dag.MarshalCompact()
+	assert.Nil(t, err)
+	return data
+}
+
+func TestDag_MarshalCompactIndexGap(t *testing.T) {
+	dag1 := NewDag()
+	dag1.addNodeWithIndex(0, 0)
+	dag1.addNodeWithIndex(5, 5)
+	dag1.addNodeWithIndex(300, 300)
+	dag1.AddEdge(0, 300)
+
+	dag2, err := UnmarshalCompactDag(mustMarshalCompact(t, dag1))
+	assert.Nil(t, err)
+	assert.True(t, dag1.Equal(dag2))
+	assert.Equal(t, 300, dag2.GetNode(300).Index())
+}
+
+func TestDag_UnmarshalCompactInvalid(t *testing.T) {
+	dag := GenerateRandomDag(20, 2, 1)
+	data := mustMarshalCompact(t, dag)
+
+	for i := 0; i < len(data); i++ {
+		_, err := UnmarshalCompactDag(data[:i])
+		assert.NotNil(t, err, "truncated at %d", i)
+	}
+	_, err := UnmarshalCompactDag(append(data, 0))
+	assert.Equal(t, ErrInvalidCompactDag, err)
+
+	// edge to a node out of range
+	_, err = UnmarshalCompactDag([]byte{1, compactIndexKey, 1, 0, 2})
+	assert.Equal(t, ErrInvalidCompactDag, err)
+	_, err = UnmarshalCompactDag([]byte{1, compactIndexKey, 1, 0, 1})
+	assert.Equal(t, ErrInvalidCompactDag, err)
+	// duplicated key
+	_, err = UnmarshalCompactDag([]byte{2, compactIntKey, 4, compactIntKey, 4, 0})
+	assert.Equal(t, ErrKeyIsExisted, err)
+	// self loop
+	_, err = UnmarshalCompactDag([]byte{1, compactIndexKey, 1, 0, 0})
+	assert.Equal(t, ErrSelfLoop, err)
+}
+
+func TestDag_MarshalCompactSize(t *testing.T) {
+	// a block of 2000 transactions with int keys, as restored by FromProto
+	dag := NewDag()
+	for i := 0; i < 2000; i++ {
+		dag.AddNode(i)
+	}
+	random := GenerateRandomDag(2000, 1.5, 7)
+	for key, node := range random.nodes {
+		for _, child := range node.children {
+			dag.AddEdge(random.nodes[key].index, child.index)
+		}
+	}
+
+	msg, err := dag.ToProto()
+	assert.Nil(t, err)
+	pb, err := proto.Marshal(msg)
+	assert.Nil(t, err)
+	compact := mustMarshalCompact(t, dag)
+
+	t.Logf("nodes %d, edges %d: protobuf %d bytes, compact %d bytes", dag.Len(), dag.Stats().Edges, len(pb), len(compact))
+	assert.True(t, len(compact) < len(pb))
+
+	restored, err := UnmarshalCompactDag(compact)
+	assert.Nil(t, err)
+	assert.True(t, dag.Equal(restored))
+}
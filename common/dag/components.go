@@ -0,0 +1,80 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+// ConnectedComponents split the dag into its weakly connected components, each returned as
+// its own dag that can be dispatched independently. Components are ordered by their lowest
+// key, nodes are reindexed from 0 in key order and keep their labels, see sortNodes.
+// ErrDagHasCirclular is returned if the dag has cycles.
+func (dag *Dag) ConnectedComponents() ([]*Dag, error) {
+	if dag.IsCirclular() {
+		return nil, ErrDagHasCirclular
+	}
+
+	component := make(map[*Node]int, dag.Len())
+	members := make([][]*Node, 0)
+	nodes := make([]*Node, 0, len(dag.nodes))
+	for _, node := range dag.nodes {
+		nodes = append(nodes, node)
+	}
+	sortNodes(nodes)
+	for _, root := range nodes {
+		if component[root] > 0 {
+			continue
+		}
+		// component ids start from 1, 0 means unvisited
+		id := len(members) + 1
+		component[root] = id
+		queue := []*Node{root}
+		for j := 0; j < len(queue); j++ {
+			for _, next := range append(append([]*Node{}, queue[j].children...), queue[j].parents...) {
+				if component[next] == 0 {
+					component[next] = id
+					queue = append(queue, next)
+				}
+			}
+		}
+		members = append(members, queue)
+	}
+
+	dags := make([]*Dag, len(members))
+	for i, nodes := range members {
+		d := NewDagWithKeyFunc(dag.keyFunc)
+		d.SetKeyMarshaler(dag.keyMarshaler, dag.keyUnmarshaler)
+		order := nodes
+		sortNodes(order)
+		for idx, node := range order {
+			d.nodes[node.key] = NewNode(node.key, idx)
+			d.indexs[idx] = node.key
+			node.copyLabels(d.nodes[node.key])
+		}
+		d.index = len(order)
+		for _, node := range order {
+			from := d.nodes[node.key]
+			for _, child := range sortedChildren(node) {
+				to := d.nodes[child.key]
+				from.children = append(from.children, to)
+				to.parents = append(to.parents, from)
+				to.parentCounter++
+			}
+		}
+		dags[i] = d
+	}
+	return dags, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDag_ConnectedComponents(t *testing.T) {
+	dag := NewDag()
+	for i := 0; i < 10; i++ {
+		dag.AddNode(i)
+	}
+	// {0, 3, 6, 9} {1, 4, 7} {2, 5, 8}, the second one joined through a common child
+	dag.AddEdge(0, 3)
+	dag.AddEdge(3, 6)
+	dag.AddEdge(0, 9)
+	dag.AddEdge(1, 7)
+	dag.AddEdge(4, 7)
+	dag.AddEdge(8, 5)
+	dag.AddEdge(5, 2)
+	dag.GetNode(4).SetLabel("color", "red")
+
+	components, err := dag.ConnectedComponents()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(components))
+
+	expected := [][]interface{}{{0, 3, 6, 9}, {1, 4, 7}, {2, 5, 8}}
+	seen := make(map[interface{}]bool)
+	edges := 0
+	for i, component := range components {
+		assert.Equal(t, len(expected[i]), component.Len())
+		for idx, key := range expected[i] {
+			node := component.GetNode(key)
+			assert.NotNil(t, node)
+			assert.Equal(t, idx, node.Index())
+			assert.False(t, seen[key])
+			seen[key] = true
+
+			// the same edges and recomputed counters
+			orig := dag.GetNode(key)
+			assert.Equal(t, len(orig.children), len(node.children))
+			for j, child := range node.children {
+				assert.Equal(t, orig.children[j].key, child.key)
+				assert.Equal(t, component.GetNode(child.key), child)
+			}
+			assert.Equal(t, len(orig.parents), node.parentCounter)
+			edges += len(node.children)
+		}
+		assert.False(t, component.IsCirclular())
+		assert.Nil(t, NewDispatcher(component, 2, 0, nil, func(node *Node, context interface{}) error {
+			return nil
+		}).Run())
+	}
+	assert.Equal(t, dag.Len(), len(seen))
+	assert.Equal(t, 7, edges)
+	color, _ := components[1].GetNode(4).Label("color")
+	assert.Equal(t, "red", color)
+
+	components, err = NewDag().ConnectedComponents()
+	assert.Nil(t, err)
+	assert.Empty(t, components)
+
+	dag.AddEdge(9, 0)
+	_, err = dag.ConnectedComponents()
+	assert.Equal(t, ErrDagHasCirclular, err)
+}
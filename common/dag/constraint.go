@@ -0,0 +1,129 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+// Constraint orders the node Before ahead of the node After without an edge in the dag
+type Constraint struct {
+	Before interface{}
+	After  interface{}
+}
+
+// SetConstraints add policy orderings the dispatcher treats as edges, the dag itself is not
+// modified and the callbacks get the nodes of the dag. A new set replaces the previous one.
+// ErrDagHasCirclular is returned and nothing is changed if the constraints would make a cycle
+// with the edges of the dag. It should be called before Run, and again with the same constraints
+// on a dispatcher restored from a checkpoint, checkpoints don't save them.
+func (dp *Dispatcher) SetConstraints(constraints []Constraint) error {
+	dp.muTask.Lock()
+	defer dp.muTask.Unlock()
+
+	after := make(map[*Node][]*Node)
+	before := make(map[*Node][]*Node)
+	seen := make(map[[2]*Node]bool)
+	for _, c := range constraints {
+		from, ok := dp.dag.nodes[dp.dag.keyOf(c.Before)]
+		if !ok {
+			return ErrKeyNotFound
+		}
+		to, ok := dp.dag.nodes[dp.dag.keyOf(c.After)]
+		if !ok {
+			return ErrKeyNotFound
+		}
+		if from == to {
+			return ErrSelfLoop
+		}
+		// the order may already be an edge of the dag
+		if seen[[2]*Node{from, to}] || hasChild(from, to) {
+			continue
+		}
+		seen[[2]*Node{from, to}] = true
+		after[from] = append(after[from], to)
+		before[to] = append(before[to], from)
+	}
+	if !dp.dag.acyclicWith(after) {
+		return ErrDagHasCirclular
+	}
+	for _, nodes := range after {
+		sortNodes(nodes)
+	}
+
+	// tasks created before, by Cancel or a restored checkpoint, wait on the new set instead
+	for _, task := range dp.tasks {
+		task.dependence += dp.pendingBefore(before[task.node]) - dp.pendingBefore(dp.before[task.node])
+	}
+	dp.after, dp.before = after, before
+	return nil
+}
+
+// pendingBefore return the number of nodes neither completed nor cancelled,
+// must be called with muTask held
+func (dp *Dispatcher) pendingBefore(nodes []*Node) int {
+	pending := 0
+	for _, node := range nodes {
+		if !dp.completed[node.key] && !dp.cancelled[node.key] {
+			pending++
+		}
+	}
+	return pending
+}
+
+// initialDependence return the number of parents and constraints the node waits on
+// before any node completed, must be called with muTask held
+func (dp *Dispatcher) initialDependence(node *Node) int {
+	return node.parentCounter + dp.pendingBefore(dp.before[node])
+}
+
+func hasChild(node, child *Node) bool {
+	for _, c := range node.children {
+		if c == child {
+			return true
+		}
+	}
+	return false
+}
+
+// acyclicWith return whether the dag stays acyclic with the extra edges
+func (dag *Dag) acyclicWith(extra map[*Node][]*Node) bool {
+	dependence := make(map[*Node]int, len(dag.nodes))
+	for _, node := range dag.nodes {
+		for _, child := range node.children {
+			dependence[child]++
+		}
+		for _, child := range extra[node] {
+			dependence[child]++
+		}
+	}
+	queue := make([]*Node, 0, len(dag.nodes))
+	for _, node := range dag.nodes {
+		if dependence[node] == 0 {
+			queue = append(queue, node)
+		}
+	}
+	for i := 0; i < len(queue); i++ {
+		for _, children := range [][]*Node{queue[i].children, extra[queue[i]]} {
+			for _, child := range children {
+				dependence[child]--
+				if dependence[child] == 0 {
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+	return len(queue) == len(dag.nodes)
+}
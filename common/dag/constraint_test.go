@@ -0,0 +1,136 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcher_SetConstraints(t *testing.T) {
+	dag := NewDag()
+	for _, key := range []string{"fee1", "fee2", "refund1", "refund2", "transfer"} {
+		dag.AddNode(key)
+	}
+	dag.AddEdge("fee1", "transfer")
+
+	var mu sync.Mutex
+	order := make([]interface{}, 0)
+	nodes := make(map[interface{}]*Node)
+	dp := NewDispatcher(dag, 4, 0, nil, func(node *Node, context interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, node.key)
+		nodes[node.key] = node
+		return nil
+	})
+	assert.Nil(t, dp.SetConstraints([]Constraint{
+		{Before: "fee1", After: "refund1"},
+		{Before: "fee1", After: "refund2"},
+		{Before: "fee2", After: "refund1"},
+		{Before: "fee2", After: "refund2"},
+		{Before: "fee1", After: "transfer"},
+	}))
+	assert.Nil(t, dp.Run())
+
+	pos := make(map[interface{}]int, len(order))
+	for i, key := range order {
+		pos[key] = i
+	}
+	assert.Equal(t, 5, len(pos))
+	for _, fee := range []string{"fee1", "fee2"} {
+		for _, refund := range []string{"refund1", "refund2"} {
+			assert.True(t, pos[fee] < pos[refund])
+		}
+	}
+
+	// the dependency graph isn't changed by the constraints, callbacks get the nodes of the dag
+	assert.Equal(t, 1, len(dag.GetNode("fee1").Children()))
+	assert.Empty(t, dag.GetNode("refund1").Parents())
+	for key, node := range nodes {
+		assert.True(t, dag.GetNode(key) == node)
+	}
+}
+
+func TestDispatcher_SetConstraintsAfterCancel(t *testing.T) {
+	dag := NewDag()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		dag.AddNode(key)
+	}
+	dag.AddEdge("a", "b")
+
+	order := make([]interface{}, 0)
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		order = append(order, node.key)
+		return nil
+	})
+	// the tasks exist before the constraints are set
+	assert.Nil(t, dp.Cancel("d"))
+	assert.Nil(t, dp.SetConstraints([]Constraint{{Before: "c", After: "a"}, {Before: "d", After: "b"}}))
+	assert.Nil(t, dp.SetConstraints([]Constraint{{Before: "c", After: "a"}, {Before: "b", After: "d"}}))
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, []interface{}{"c", "a", "b"}, order)
+}
+
+func TestDispatcher_SetConstraintsInvalid(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	dag.AddNode("c")
+	dag.AddEdge("a", "b")
+
+	dp := NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		return nil
+	})
+	assert.Equal(t, ErrDagHasCirclular, dp.SetConstraints([]Constraint{
+		{Before: "b", After: "c"},
+		{Before: "c", After: "a"},
+	}))
+	assert.Equal(t, ErrKeyNotFound, dp.SetConstraints([]Constraint{{Before: "a", After: "d"}}))
+	assert.Equal(t, ErrSelfLoop, dp.SetConstraints([]Constraint{{Before: "a", After: "a"}}))
+
+	// a rejected set leaves the dispatcher unchanged
+	assert.Equal(t, dag, dp.dag)
+	assert.Nil(t, dp.Run())
+}
+
+func TestDispatcher_SetConstraintsRestore(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	constraints := []Constraint{{Before: "a", After: "b"}}
+
+	dp := NewDispatcher(dag, 2, 0, nil, nil)
+	assert.Nil(t, dp.SetConstraints(constraints))
+	data, err := dp.Checkpoint()
+	assert.Nil(t, err)
+
+	executed := make([]interface{}, 0)
+	restored, err := RestoreDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		executed = append(executed, node.key)
+		return nil
+	}, data)
+	assert.Nil(t, err)
+	assert.Nil(t, restored.SetConstraints(constraints))
+	assert.Nil(t, restored.DryRun())
+	assert.Nil(t, restored.Run())
+	assert.Equal(t, []interface{}{"a", "b"}, executed)
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+// Edge is an edge of the dag from the node From to the node To
+type Edge struct {
+	From interface{}
+	To   interface{}
+}
+
+// SuggestCycleBreaks return edges whose removal makes the graph acyclic, nil if it has no cycle.
+// Finding the minimum such set is NP-hard, the greedy ordering heuristic of Eades, Lin and Smyth
+// is used instead: sinks are moved to the end of the order and sources to the front, otherwise
+// the node with the largest out-degree minus in-degree goes to the front, and the edges pointing
+// backwards in the order are suggested. Edges not needed to break any cycle are then put back,
+// so no suggested edge can be kept alone. Edges are ordered by their From node, then their
+// To node, see sortNodes.
+func (dag *Dag) SuggestCycleBreaks() ([]Edge, error) {
+	nodes := dag.GetNodes()
+	sortNodes(nodes)
+
+	// order the nodes, removing them from the graph one by one
+	indegree := make(map[*Node]int, len(nodes))
+	outdegree := make(map[*Node]int, len(nodes))
+	for _, node := range nodes {
+		outdegree[node] = len(node.children)
+		for _, child := range node.children {
+			indegree[child]++
+		}
+	}
+	removed := make(map[*Node]bool, len(nodes))
+	remove := func(node *Node) {
+		removed[node] = true
+		for _, child := range node.children {
+			indegree[child]--
+		}
+		for _, parent := range node.parents {
+			outdegree[parent]--
+		}
+	}
+
+	front := make([]*Node, 0, len(nodes))
+	back := make([]*Node, 0)
+	for len(removed) < len(nodes) {
+		changed := true
+		for changed {
+			changed = false
+			for _, node := range nodes {
+				if removed[node] {
+					continue
+				}
+				if outdegree[node] == 0 {
+					remove(node)
+					back = append(back, node)
+					changed = true
+				} else if indegree[node] == 0 {
+					remove(node)
+					front = append(front, node)
+					changed = true
+				}
+			}
+		}
+
+		var best *Node
+		for _, node := range nodes {
+			if removed[node] {
+				continue
+			}
+			if best == nil || outdegree[node]-indegree[node] > outdegree[best]-indegree[best] {
+				best = node
+			}
+		}
+		if best != nil {
+			remove(best)
+			front = append(front, best)
+		}
+	}
+
+	// sinks are removed last first, they follow the front in reverse order
+	position := make(map[*Node]int, len(nodes))
+	for i, node := range front {
+		position[node] = i
+	}
+	for i, node := range back {
+		position[node] = len(nodes) - 1 - i
+	}
+
+	breaks := make(map[*Node]map[*Node]bool)
+	candidates := make([]Edge, 0)
+	for _, node := range nodes {
+		for _, child := range sortedChildren(node) {
+			if position[child] <= position[node] {
+				if breaks[node] == nil {
+					breaks[node] = make(map[*Node]bool)
+				}
+				breaks[node][child] = true
+				candidates = append(candidates, Edge{From: node.key, To: child.key})
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// put back the edges which close no cycle with the edges kept so far
+	edges := make([]Edge, 0, len(candidates))
+	for _, edge := range candidates {
+		from, to := dag.nodes[edge.From], dag.nodes[edge.To]
+		delete(breaks[from], to)
+		if reachable(to, from, breaks) {
+			breaks[from][to] = true
+			edges = append(edges, edge)
+		}
+	}
+	return edges, nil
+}
+
+// reachable return whether to can be reached from from without the edges in skip
+func reachable(from, to *Node, skip map[*Node]map[*Node]bool) bool {
+	visited := map[*Node]bool{from: true}
+	stack := []*Node{from}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == to {
+			return true
+		}
+		for _, child := range node.children {
+			if visited[child] || skip[node][child] {
+				continue
+			}
+			visited[child] = true
+			stack = append(stack, child)
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withoutEdges return a copy of the dag without the edges
+func withoutEdges(dag *Dag, edges []Edge) *Dag {
+	skip := make(map[Edge]bool, len(edges))
+	for _, edge := range edges {
+		skip[edge] = true
+	}
+	d := NewDag()
+	for i := 0; i <= dag.index; i++ {
+		if key, ok := dag.indexs[i]; ok {
+			d.AddNode(key)
+		}
+	}
+	for _, node := range dag.nodes {
+		for _, child := range node.children {
+			if !skip[Edge{From: node.key, To: child.key}] {
+				d.AddEdge(node.key, child.key)
+			}
+		}
+	}
+	return d
+}
+
+func assertCycleBreaks(t *testing.T, dag *Dag, expectLen int) []Edge {
+	edges, err := dag.SuggestCycleBreaks()
+	assert.Nil(t, err)
+	assert.Equal(t, expectLen, len(edges))
+	assert.Nil(t, withoutEdges(dag, edges).Validate())
+
+	// every suggested edge closes a cycle on its own
+	for i := range edges {
+		rest := append(append([]Edge{}, edges[:i]...), edges[i+1:]...)
+		assert.Equal(t, ErrDagHasCirclular, withoutEdges(dag, rest).Validate(), "%v", edges[i])
+	}
+	return edges
+}
+
+func TestDag_SuggestCycleBreaks(t *testing.T) {
+	dag := GenerateLayeredDag(3, 3)
+	edges, err := dag.SuggestCycleBreaks()
+	assert.Nil(t, err)
+	assert.Nil(t, edges)
+
+	// 1 -> 2 -> 3 -> 1
+	dag = NewDag()
+	for i := 1; i <= 4; i++ {
+		dag.AddNode(i)
+	}
+	dag.AddEdge(1, 2)
+	dag.AddEdge(2, 3)
+	dag.AddEdge(3, 1)
+	dag.AddEdge(3, 4)
+	assertCycleBreaks(t, dag, 1)
+
+	// two cycles sharing the edge 2 -> 3 are broken by it
+	dag.AddNode(5)
+	dag.AddEdge(3, 5)
+	dag.AddEdge(5, 2)
+	assert.Equal(t, []Edge{{From: 2, To: 3}}, assertCycleBreaks(t, dag, 1))
+
+	// disjoint cycles need an edge each
+	dag = NewDag()
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		dag.AddNode(key)
+	}
+	dag.AddEdge("a", "b")
+	dag.AddEdge("b", "a")
+	dag.AddEdge("c", "d")
+	dag.AddEdge("d", "e")
+	dag.AddEdge("e", "c")
+	assertCycleBreaks(t, dag, 2)
+}
+
+func TestDag_SuggestCycleBreaksRandom(t *testing.T) {
+	total := 0
+	for seed := int64(0); seed < 10; seed++ {
+		dag := GenerateRandomDag(30, 2, seed)
+		// reversed edges make cycles
+		nodes := dag.GetNodes()
+		for i := 0; i < 5; i++ {
+			node := nodes[(int(seed)+i*7)%len(nodes)]
+			for _, child := range node.children {
+				dag.AddEdge(child.key, node.key)
+				break
+			}
+		}
+		edges, err := dag.SuggestCycleBreaks()
+		assert.Nil(t, err)
+		total += len(edges)
+		assert.Nil(t, withoutEdges(dag, edges).Validate())
+		for i := range edges {
+			rest := append(append([]Edge{}, edges[:i]...), edges[i+1:]...)
+			assert.Equal(t, ErrDagHasCirclular, withoutEdges(dag, rest).Validate())
+		}
+	}
+	assert.True(t, total > 0)
+}
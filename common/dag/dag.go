@@ -17,8 +17,13 @@
 package dag
 
 import (
+	"bytes"
+	"container/heap"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/nebulasio/go-nebulas/common/dag/pb"
@@ -29,7 +34,10 @@ type Node struct {
 	key           interface{}
 	index         int
 	children      []*Node
+	parents       []*Node
 	parentCounter int
+	labels        map[string]string
+	group         string
 }
 
 // Errors
@@ -38,6 +46,9 @@ var (
 	ErrKeyIsExisted      = errors.New("already existed")
 	ErrInvalidProtoToDag = errors.New("Protobuf message cannot be converted into Dag")
 	ErrInvalidDagToProto = errors.New("Dag cannot be converted into Protobuf message")
+	ErrSelfLoop          = errors.New("edge from a node to itself")
+	ErrInvalidCompactDag = errors.New("invalid compact dag encoding")
+	ErrInvalidJSONKey    = errors.New("node key in JSON is not a string, number or bool")
 )
 
 // NewNode new node
@@ -55,19 +66,97 @@ func (n *Node) Index() int {
 	return n.index
 }
 
+// Children return the child nodes of the node
+func (n *Node) Children() []*Node {
+	children := make([]*Node, len(n.children))
+	copy(children, n.children)
+	return children
+}
+
+// Parents return the parent nodes of the node
+func (n *Node) Parents() []*Node {
+	parents := make([]*Node, len(n.parents))
+	copy(parents, n.parents)
+	return parents
+}
+
+// SetLabel set the metadata label k of the node
+func (n *Node) SetLabel(k, v string) {
+	if n.labels == nil {
+		n.labels = make(map[string]string)
+	}
+	n.labels[k] = v
+}
+
+// Label return the metadata label k of the node
+func (n *Node) Label(k string) (string, bool) {
+	v, ok := n.labels[k]
+	return v, ok
+}
+
+// SetExclusionGroup put the node in the exclusion group, the dispatcher runs at most
+// one node of a group at a time. The empty group, the default, doesn't exclude any node.
+func (n *Node) SetExclusionGroup(group string) {
+	n.group = group
+}
+
+// ExclusionGroup return the exclusion group of the node
+func (n *Node) ExclusionGroup() string {
+	return n.group
+}
+
+// copyLabels copy the labels and the exclusion group of n to other
+func (n *Node) copyLabels(other *Node) {
+	for k, v := range n.labels {
+		other.SetLabel(k, v)
+	}
+	other.group = n.group
+}
+
+// dotLabel return the label in dot format, metadata labels are sorted by name
+func (n *Node) dotLabel() string {
+	label := n.String()
+	names := make([]string, 0, len(n.labels))
+	for k := range n.labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		label += "\n" + k + "=" + n.labels[k]
+	}
+	return label
+}
+
+// String return the label of the node, the key's String() is used
+// if the key implements fmt.Stringer
+func (n *Node) String() string {
+	if s, ok := n.key.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(n.key)
+}
+
 // Dag struct
 type Dag struct {
-	nodes  map[interface{}]*Node
-	index  int
-	indexs map[int]interface{}
+	nodes          map[interface{}]*Node
+	index          int
+	indexs         map[int]interface{}
+	keyFunc        KeyFunc
+	keyMarshaler   KeyMarshaler
+	keyUnmarshaler KeyUnmarshaler
 }
 
 // ToProto converts domain Dag into proto Dag
 func (dag *Dag) ToProto() (proto.Message, error) {
 
-	nodes := make([]*dagpb.Node, len(dag.nodes))
+	nodes := make([]*dagpb.Node, 0, len(dag.nodes))
 
-	for idx, key := range dag.indexs {
+	// in index order, indexes may have gaps after Prune
+	for idx := 0; idx <= dag.index; idx++ {
+		key, ok := dag.indexs[idx]
+		if !ok {
+			continue
+		}
 		v, ok := dag.nodes[key]
 		if !ok {
 			return nil, ErrInvalidDagToProto
@@ -81,7 +170,7 @@ func (dag *Dag) ToProto() (proto.Message, error) {
 			node.Children[i] = int32(child.index)
 		}
 
-		nodes[idx] = node
+		nodes = append(nodes, node)
 	}
 
 	return &dagpb.Dag{
@@ -119,6 +208,32 @@ func (dag *Dag) String() string {
 	return string(j)
 }
 
+// ToDot return the dag in graphviz dot format, nodes are ordered by index
+func (dag *Dag) ToDot() string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph dag {\n")
+	for i := 0; i <= dag.index; i++ {
+		key, ok := dag.indexs[i]
+		if !ok {
+			continue
+		}
+		node := dag.nodes[key]
+		buf.WriteString(fmt.Sprintf("\t%d [label=%s];\n", node.index, strconv.Quote(node.dotLabel())))
+	}
+	for i := 0; i <= dag.index; i++ {
+		key, ok := dag.indexs[i]
+		if !ok {
+			continue
+		}
+		node := dag.nodes[key]
+		for _, child := range node.children {
+			buf.WriteString(fmt.Sprintf("\t%d -> %d;\n", node.index, child.index))
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
 // NewDag new dag
 func NewDag() *Dag {
 	return &Dag{
@@ -128,6 +243,119 @@ func NewDag() *Dag {
 	}
 }
 
+// NewDagWithKeyFunc new dag whose keys are converted by keyFunc before indexing,
+// see InternBytesKey and InternHexKey
+func NewDagWithKeyFunc(keyFunc KeyFunc) *Dag {
+	dag := NewDag()
+	dag.keyFunc = keyFunc
+	return dag
+}
+
+// keyOf return the key used to index the dag
+func (dag *Dag) keyOf(key interface{}) interface{} {
+	if dag.keyFunc == nil {
+		return key
+	}
+	return dag.keyFunc(key)
+}
+
+// clone return a deep copy of the dag, nodes keep their keys and indexes
+func (dag *Dag) clone() *Dag {
+	d := NewDagWithKeyFunc(dag.keyFunc)
+	d.SetKeyMarshaler(dag.keyMarshaler, dag.keyUnmarshaler)
+	d.index = dag.index
+	for key, node := range dag.nodes {
+		d.nodes[key] = NewNode(key, node.index)
+		d.nodes[key].parentCounter = node.parentCounter
+		node.copyLabels(d.nodes[key])
+	}
+	for idx, key := range dag.indexs {
+		d.indexs[idx] = key
+	}
+	for key, node := range dag.nodes {
+		children := make([]*Node, len(node.children))
+		for i, child := range node.children {
+			children[i] = d.nodes[child.key]
+		}
+		d.nodes[key].children = children
+		parents := make([]*Node, len(node.parents))
+		for i, parent := range node.parents {
+			parents[i] = d.nodes[parent.key]
+		}
+		d.nodes[key].parents = parents
+	}
+	return d
+}
+
+// Finalize recompute every node's parent counter and parents strictly from the edges,
+// parents are ordered by index
+func (dag *Dag) Finalize() {
+	for _, node := range dag.nodes {
+		node.parentCounter = 0
+		node.parents = nil
+	}
+	for i := 0; i <= dag.index; i++ {
+		key, ok := dag.indexs[i]
+		if !ok {
+			continue
+		}
+		node := dag.nodes[key]
+		for _, child := range node.children {
+			child.parentCounter++
+			child.parents = append(child.parents, node)
+		}
+	}
+}
+
+// Transpose return a new dag with every edge reversed,
+// nodes keep their keys and indexes
+func (dag *Dag) Transpose() *Dag {
+	d := NewDagWithKeyFunc(dag.keyFunc)
+	d.SetKeyMarshaler(dag.keyMarshaler, dag.keyUnmarshaler)
+	d.index = dag.index
+	for key, node := range dag.nodes {
+		d.nodes[key] = NewNode(key, node.index)
+		node.copyLabels(d.nodes[key])
+		d.indexs[node.index] = key
+	}
+	for i := 0; i <= dag.index; i++ {
+		key, ok := dag.indexs[i]
+		if !ok {
+			continue
+		}
+		for _, child := range dag.nodes[key].children {
+			d.AddEdge(child.key, key)
+		}
+	}
+	return d
+}
+
+// Equal return whether the two dags have the same nodes and edges
+func (dag *Dag) Equal(other *Dag) bool {
+	if other == nil || dag.Len() != other.Len() {
+		return false
+	}
+	for key, node := range dag.nodes {
+		n, ok := other.nodes[key]
+		if !ok {
+			return false
+		}
+		if node.index != n.index || node.parentCounter != n.parentCounter || len(node.children) != len(n.children) {
+			return false
+		}
+		children := make(map[interface{}]bool, len(n.children))
+		for _, child := range n.children {
+			children[child.key] = true
+		}
+		for _, child := range node.children {
+			if !children[child.key] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // Len Dag len
 func (dag *Dag) Len() int {
 	return len(dag.nodes)
@@ -135,7 +363,7 @@ func (dag *Dag) Len() int {
 
 // GetNode get node by key
 func (dag *Dag) GetNode(key interface{}) *Node {
-	if v, ok := dag.nodes[key]; ok {
+	if v, ok := dag.nodes[dag.keyOf(key)]; ok {
 		return v
 	}
 	return nil
@@ -143,14 +371,22 @@ func (dag *Dag) GetNode(key interface{}) *Node {
 
 // GetChildrenNodes get children nodes with key
 func (dag *Dag) GetChildrenNodes(key interface{}) []*Node {
-	if v, ok := dag.nodes[key]; ok {
+	if v, ok := dag.nodes[dag.keyOf(key)]; ok {
 		return v.children
 	}
 
 	return nil
 }
 
-// GetRootNodes get root nodes
+// ChildrenNodes get children nodes with key, return ErrKeyNotFound if the key is unknown
+func (dag *Dag) ChildrenNodes(key interface{}) ([]*Node, error) {
+	if v, ok := dag.nodes[dag.keyOf(key)]; ok {
+		return v.children, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// GetRootNodes get the nodes without parents sorted by key
 func (dag *Dag) GetRootNodes() []*Node {
 	nodes := make([]*Node, 0)
 	for _, node := range dag.nodes {
@@ -158,10 +394,75 @@ func (dag *Dag) GetRootNodes() []*Node {
 			nodes = append(nodes, node)
 		}
 	}
+	sortNodes(nodes)
+	return nodes
+}
+
+// GetLeafNodes get the nodes without children sorted by key
+func (dag *Dag) GetLeafNodes() []*Node {
+	nodes := make([]*Node, 0)
+	for _, node := range dag.nodes {
+		if len(node.children) == 0 {
+			nodes = append(nodes, node)
+		}
+	}
+	sortNodes(nodes)
 	return nodes
 }
 
-// GetNodes get all nodes
+// TopologicalSort return the nodes with every node before its children, among the nodes
+// whose parents are all placed the smallest key goes first, see sortNodes.
+// ErrDagHasCirclular is returned if the dag has cycles.
+func (dag *Dag) TopologicalSort() ([]*Node, error) {
+	dependence := make(map[*Node]int, len(dag.nodes))
+	for _, node := range dag.nodes {
+		for _, child := range node.children {
+			dependence[child]++
+		}
+	}
+	ready := &nodeHeap{}
+	for _, node := range dag.nodes {
+		if dependence[node] == 0 {
+			heap.Push(ready, node)
+		}
+	}
+
+	nodes := make([]*Node, 0, len(dag.nodes))
+	for ready.Len() > 0 {
+		node := heap.Pop(ready).(*Node)
+		nodes = append(nodes, node)
+		for _, child := range node.children {
+			dependence[child]--
+			if dependence[child] == 0 {
+				heap.Push(ready, child)
+			}
+		}
+	}
+	if len(nodes) != len(dag.nodes) {
+		return nil, ErrDagHasCirclular
+	}
+	return nodes, nil
+}
+
+// nodeHeap is a min heap of nodes in sortNodes order
+type nodeHeap []*Node
+
+func (h nodeHeap) Len() int { return len(h) }
+
+func (h nodeHeap) Less(i, j int) bool { return lessNode(h[i], h[j]) }
+
+func (h nodeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *nodeHeap) Push(x interface{}) { *h = append(*h, x.(*Node)) }
+
+func (h *nodeHeap) Pop() interface{} {
+	old := *h
+	node := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return node
+}
+
+// GetNodes get all nodes, in no particular order
 func (dag *Dag) GetNodes() []*Node {
 	nodes := make([]*Node, 0)
 	for _, node := range dag.nodes {
@@ -172,6 +473,7 @@ func (dag *Dag) GetNodes() []*Node {
 
 // AddNode add node
 func (dag *Dag) AddNode(key interface{}) error {
+	key = dag.keyOf(key)
 	if _, ok := dag.nodes[key]; ok {
 		return ErrKeyIsExisted
 	}
@@ -184,6 +486,7 @@ func (dag *Dag) AddNode(key interface{}) error {
 
 // addNodeWithIndex add node
 func (dag *Dag) addNodeWithIndex(key interface{}, index int) error {
+	key = dag.keyOf(key)
 	if _, ok := dag.nodes[key]; ok {
 		return ErrKeyIsExisted
 	}
@@ -199,6 +502,8 @@ func (dag *Dag) AddEdge(fromKey, toKey interface{}) error {
 	var from, to *Node
 	var ok bool
 
+	fromKey, toKey = dag.keyOf(fromKey), dag.keyOf(toKey)
+
 	if from, ok = dag.nodes[fromKey]; !ok {
 		return ErrKeyNotFound
 	}
@@ -207,6 +512,10 @@ func (dag *Dag) AddEdge(fromKey, toKey interface{}) error {
 		return ErrKeyNotFound
 	}
 
+	if from == to {
+		return ErrSelfLoop
+	}
+
 	for _, childNode := range from.children {
 		if childNode == to {
 			return ErrKeyIsExisted
@@ -214,11 +523,233 @@ func (dag *Dag) AddEdge(fromKey, toKey interface{}) error {
 	}
 
 	dag.nodes[toKey].parentCounter++
+	dag.nodes[toKey].parents = append(to.parents, from)
 	dag.nodes[fromKey].children = append(from.children, to)
 
 	return nil
 }
 
+// Prune remove the failed nodes and every node depending on them directly or transitively,
+// so only the nodes that can still run are left, and return the removed keys ordered by key,
+// see sortNodes.
+// The other nodes keep their indexes. ErrKeyNotFound is returned if a failed key is not
+// in the dag, the dag is then unchanged.
+func (dag *Dag) Prune(failed []interface{}) ([]interface{}, error) {
+	queue := make([]*Node, 0, len(failed))
+	removed := make(map[*Node]bool)
+	for _, key := range failed {
+		node, ok := dag.nodes[dag.keyOf(key)]
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+		if !removed[node] {
+			removed[node] = true
+			queue = append(queue, node)
+		}
+	}
+	for i := 0; i < len(queue); i++ {
+		for _, child := range queue[i].children {
+			if !removed[child] {
+				removed[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	sortNodes(queue)
+	keys := make([]interface{}, len(queue))
+	for i, node := range queue {
+		keys[i] = node.key
+		delete(dag.nodes, node.key)
+		delete(dag.indexs, node.index)
+		// the parents left lose the removed node as a child
+		for _, parent := range node.parents {
+			if removed[parent] {
+				continue
+			}
+			children := make([]*Node, 0, len(parent.children)-1)
+			for _, child := range parent.children {
+				if child != node {
+					children = append(children, child)
+				}
+			}
+			parent.children = children
+		}
+	}
+	return keys, nil
+}
+
+// Levels return the level of each node, which is the longest path distance
+// from any root node, ErrDagHasCirclular is returned if the dag has cycles
+func (dag *Dag) Levels() (map[interface{}]int, error) {
+	levels := make(map[interface{}]int, len(dag.nodes))
+	dependences := make(map[interface{}]int, len(dag.nodes))
+	queue := make([]*Node, 0, len(dag.nodes))
+	for key := range dag.nodes {
+		dependences[key] = 0
+	}
+	for _, node := range dag.nodes {
+		for _, child := range node.children {
+			dependences[child.key]++
+		}
+	}
+	for key, node := range dag.nodes {
+		if dependences[key] == 0 {
+			levels[key] = 0
+			queue = append(queue, node)
+		}
+	}
+
+	for i := 0; i < len(queue); i++ {
+		node := queue[i]
+		for _, child := range node.children {
+			if levels[node.key]+1 > levels[child.key] {
+				levels[child.key] = levels[node.key] + 1
+			}
+			dependences[child.key]--
+			if dependences[child.key] == 0 {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	if len(queue) != len(dag.nodes) {
+		return nil, ErrDagHasCirclular
+	}
+	return levels, nil
+}
+
+// Generations return the nodes grouped by level, generation 0 holds the roots and
+// every other node is in the generation after its deepest parent. Nodes in a generation
+// are sorted by key, see lessKey. ErrDagHasCirclular is returned if the dag has cycles.
+func (dag *Dag) Generations() ([][]*Node, error) {
+	levels, err := dag.Levels()
+	if err != nil {
+		return nil, err
+	}
+	generations := make([][]*Node, 0)
+	for key, level := range levels {
+		for len(generations) <= level {
+			generations = append(generations, make([]*Node, 0))
+		}
+		generations[level] = append(generations[level], dag.nodes[key])
+	}
+	for _, nodes := range generations {
+		sortNodes(nodes)
+	}
+	return generations, nil
+}
+
+// sortNodes sort the nodes by key, see lessKey. It's the tie-break rule of every dag
+// algorithm returning or visiting nodes in some order, so that the same graph gives
+// the same output whatever the order it was built in.
+func sortNodes(nodes []*Node) {
+	sort.Slice(nodes, func(i, j int) bool { return lessNode(nodes[i], nodes[j]) })
+}
+
+func lessNode(a, b *Node) bool {
+	return lessKey(a.key, b.key)
+}
+
+// sortedChildren return a copy of the children of the node sorted by sortNodes
+func sortedChildren(node *Node) []*Node {
+	children := make([]*Node, len(node.children))
+	copy(children, node.children)
+	sortNodes(children)
+	return children
+}
+
+// lessKey order keys, ints numerically before the other keys, which are ordered
+// lexicographically by their string form, then by their type name when they print
+// the same, e.g. "1" and int64(1), then by their Go syntax representation
+func lessKey(a, b interface{}) bool {
+	x, xInt := a.(int)
+	y, yInt := b.(int)
+	switch {
+	case xInt && yInt:
+		return x < y
+	case xInt || yInt:
+		return xInt
+	}
+	if s, ok := a.(string); ok {
+		if t, ok := b.(string); ok {
+			return s < t
+		}
+	}
+	if s, t := fmt.Sprint(a), fmt.Sprint(b); s != t {
+		return s < t
+	}
+	if s, t := fmt.Sprintf("%T", a), fmt.Sprintf("%T", b); s != t {
+		return s < t
+	}
+	return fmt.Sprintf("%#v", a) < fmt.Sprintf("%#v", b)
+}
+
+// Depth return the number of levels in the dag, 0 if the dag is empty or has cycles
+func (dag *Dag) Depth() int {
+	levels, err := dag.Levels()
+	if err != nil {
+		return 0
+	}
+	depth := 0
+	for _, level := range levels {
+		if level+1 > depth {
+			depth = level + 1
+		}
+	}
+	return depth
+}
+
+// DagStats is the summary of a dag
+type DagStats struct {
+	Nodes    int
+	Edges    int
+	Roots    int
+	Leaves   int
+	MaxDepth int
+	Acyclic  bool
+}
+
+// Stats return the summary of the dag,
+// MaxDepth is the number of levels as Depth, 0 if the dag has cycles
+func (dag *Dag) Stats() DagStats {
+	stats := DagStats{Nodes: len(dag.nodes)}
+	for _, node := range dag.nodes {
+		stats.Edges += len(node.children)
+		if len(node.children) == 0 {
+			stats.Leaves++
+		}
+		if len(node.parents) == 0 {
+			stats.Roots++
+		}
+	}
+
+	levels, err := dag.Levels()
+	stats.Acyclic = err == nil
+	for _, level := range levels {
+		if level+1 > stats.MaxDepth {
+			stats.MaxDepth = level + 1
+		}
+	}
+	return stats
+}
+
+// Validate check the dag could be dispatched, return ErrSelfLoop if any node
+// is its own child, ErrDagHasCirclular if there is any other cycle
+func (dag *Dag) Validate() error {
+	for _, node := range dag.nodes {
+		for _, child := range node.children {
+			if child == node {
+				return ErrSelfLoop
+			}
+		}
+	}
+	if dag.IsCirclular() {
+		return ErrDagHasCirclular
+	}
+	return nil
+}
+
 //IsCirclular a->b-c->a
 func (dag *Dag) IsCirclular() bool {
 
@@ -229,7 +760,10 @@ func (dag *Dag) IsCirclular() bool {
 		rootNodes[key] = node
 	}
 
-	for _, node := range rootNodes {
+	for key, node := range rootNodes {
+		if visited[key] == 2 {
+			continue
+		}
 		if dag.hasCirclularDep(node, visited) {
 			return true
 		}
@@ -250,6 +784,11 @@ func (dag *Dag) hasCirclularDep(current *Node, visited map[interface{}]int) bool
 		if visited[child.key] == 1 {
 			return true
 		}
+		// the descendants of a finished node are known to be acyclic,
+		// walking them again is exponential in the number of paths
+		if visited[child.key] == 2 {
+			continue
+		}
 
 		if dag.hasCirclularDep(child, visited) {
 			return true
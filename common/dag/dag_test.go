@@ -19,6 +19,8 @@
 package dag
 
 import (
+	"math/rand"
+	"strconv"
 	"testing"
 
 	"github.com/gogo/protobuf/proto"
@@ -151,6 +153,17 @@ func TestDag_IsCirclular(t *testing.T) {
 
 }
 
+func TestDag_IsCirclularManyPaths(t *testing.T) {
+	// 3^40 paths, each node must be walked once
+	dag := GenerateLayeredDag(40, 3)
+	assert.False(t, dag.IsCirclular())
+	assert.Nil(t, dag.Validate())
+
+	dag.AddEdge("39-2", "0-1")
+	assert.True(t, dag.IsCirclular())
+	assert.Equal(t, ErrDagHasCirclular, dag.Validate())
+}
+
 func TestDag_IsCirclular1(t *testing.T) {
 
 	dag := NewDag()
@@ -204,3 +217,395 @@ func TestDag_IsCirclular1(t *testing.T) {
 	dag.AddEdge("19", "16")
 	assert.Equal(t, true, dag.IsCirclular())
 }
+
+func TestDag_ChildrenNodes(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddEdge("1", "2")
+
+	children, err := dag.ChildrenNodes("1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(children))
+	assert.Equal(t, "2", children[0].key)
+
+	children, err = dag.ChildrenNodes("2")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(children))
+
+	children, err = dag.ChildrenNodes("3")
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, children)
+}
+
+type stringerKey int
+
+func (k stringerKey) String() string {
+	return "tx-" + strconv.Itoa(int(k))
+}
+
+func TestDag_ToDot(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode(stringerKey(2))
+	dag.AddNode("3")
+	dag.AddEdge("1", stringerKey(2))
+	dag.AddEdge("1", "3")
+
+	assert.Equal(t, "1", dag.GetNode("1").String())
+	assert.Equal(t, "tx-2", dag.GetNode(stringerKey(2)).String())
+
+	expected := "digraph dag {\n" +
+		"\t0 [label=\"1\"];\n" +
+		"\t1 [label=\"tx-2\"];\n" +
+		"\t2 [label=\"3\"];\n" +
+		"\t0 -> 1;\n" +
+		"\t0 -> 2;\n" +
+		"}\n"
+	assert.Equal(t, expected, dag.ToDot())
+}
+
+func TestDag_Transpose(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddNode("3")
+	dag.AddNode("4")
+	dag.AddEdge("1", "2")
+	dag.AddEdge("1", "3")
+	dag.AddEdge("2", "4")
+	dag.AddEdge("3", "4")
+
+	transposed := dag.Transpose()
+	assert.False(t, dag.Equal(transposed))
+	assert.Equal(t, 2, transposed.GetNode("1").parentCounter)
+	assert.Equal(t, 0, transposed.GetNode("4").parentCounter)
+	roots := transposed.GetRootNodes()
+	assert.Equal(t, 1, len(roots))
+	assert.Equal(t, "4", roots[0].key)
+
+	assert.True(t, dag.Equal(transposed.Transpose()))
+	assert.True(t, dag.Equal(dag))
+	assert.False(t, dag.Equal(NewDag()))
+}
+
+func TestDag_SelfLoop(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	assert.Equal(t, ErrSelfLoop, dag.AddEdge("1", "1"))
+	assert.Equal(t, 0, dag.GetNode("1").parentCounter)
+	assert.Nil(t, dag.AddEdge("1", "2"))
+	assert.Nil(t, dag.Validate())
+
+	// self-loop introduced without AddEdge
+	node := dag.GetNode("2")
+	node.children = append(node.children, node)
+	node.parentCounter++
+	assert.Equal(t, ErrSelfLoop, dag.Validate())
+
+	dag = NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddEdge("1", "2")
+	dag.AddEdge("2", "1")
+	assert.Equal(t, ErrDagHasCirclular, dag.Validate())
+}
+
+func TestDag_Finalize(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddNode("3")
+	dag.AddEdge("1", "2")
+	dag.AddEdge("1", "3")
+	dag.AddEdge("2", "3")
+
+	dag.GetNode("1").parentCounter = 5
+	dag.GetNode("3").parentCounter = 0
+	dag.Finalize()
+	assert.Equal(t, 0, dag.GetNode("1").parentCounter)
+	assert.Equal(t, 1, dag.GetNode("2").parentCounter)
+	assert.Equal(t, 2, dag.GetNode("3").parentCounter)
+}
+
+func TestDag_Levels(t *testing.T) {
+	dag := NewDag()
+	assert.Equal(t, 0, dag.Depth())
+
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddNode("3")
+	dag.AddNode("4")
+	dag.AddNode("5")
+	dag.AddEdge("1", "2")
+	dag.AddEdge("2", "3")
+	dag.AddEdge("1", "3")
+	dag.AddEdge("4", "3")
+
+	levels, err := dag.Levels()
+	assert.Nil(t, err)
+	assert.Equal(t, map[interface{}]int{"1": 0, "2": 1, "3": 2, "4": 0, "5": 0}, levels)
+	assert.Equal(t, 3, dag.Depth())
+
+	dag.AddEdge("3", "1")
+	_, err = dag.Levels()
+	assert.Equal(t, ErrDagHasCirclular, err)
+	assert.Equal(t, 0, dag.Depth())
+}
+
+func TestDag_Generations(t *testing.T) {
+	dag := NewDag()
+	generations, err := dag.Generations()
+	assert.Nil(t, err)
+	assert.Empty(t, generations)
+
+	for _, key := range []interface{}{"b", 10, "a", 2, "c", "d"} {
+		dag.AddNode(key)
+	}
+	dag.AddEdge("b", "c")
+	dag.AddEdge(10, "c")
+	dag.AddEdge("c", "d")
+	dag.AddEdge("a", "d")
+
+	keys := func(generations [][]*Node) [][]interface{} {
+		all := make([][]interface{}, len(generations))
+		for i, nodes := range generations {
+			for _, node := range nodes {
+				all[i] = append(all[i], node.key)
+			}
+		}
+		return all
+	}
+	for i := 0; i < 5; i++ {
+		generations, err = dag.Generations()
+		assert.Nil(t, err)
+		assert.Equal(t, [][]interface{}{{2, 10, "a", "b"}, {"c"}, {"d"}}, keys(generations))
+	}
+
+	dag.AddEdge("d", "b")
+	_, err = dag.Generations()
+	assert.Equal(t, ErrDagHasCirclular, err)
+}
+
+func TestNode_Label(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddEdge("1", "2")
+
+	node := dag.GetNode("1")
+	_, ok := node.Label("shard")
+	assert.False(t, ok)
+	node.SetLabel("shard", "2")
+	node.SetLabel("fee", "high")
+	v, ok := node.Label("shard")
+	assert.True(t, ok)
+	assert.Equal(t, "2", v)
+
+	expected := "digraph dag {\n" +
+		"\t0 [label=\"1\\nfee=high\\nshard=2\"];\n" +
+		"\t1 [label=\"2\"];\n" +
+		"\t0 -> 1;\n" +
+		"}\n"
+	assert.Equal(t, expected, dag.ToDot())
+
+	v, _ = dag.clone().GetNode("1").Label("fee")
+	assert.Equal(t, "high", v)
+	v, _ = dag.Transpose().GetNode("1").Label("fee")
+	assert.Equal(t, "high", v)
+
+	labels := make(chan string, 2)
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		shard, _ := node.Label("shard")
+		labels <- shard
+		return nil
+	})
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, "2", <-labels)
+	assert.Equal(t, "", <-labels)
+}
+
+func TestDag_Stats(t *testing.T) {
+	assert.Equal(t, DagStats{Acyclic: true}, NewDag().Stats())
+
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddNode("3")
+	dag.AddNode("4")
+	dag.AddNode("5")
+	dag.AddEdge("1", "2")
+	dag.AddEdge("1", "3")
+	dag.AddEdge("2", "4")
+	dag.AddEdge("3", "4")
+	assert.Equal(t, DagStats{
+		Nodes:    5,
+		Edges:    4,
+		Roots:    2,
+		Leaves:   2,
+		MaxDepth: 3,
+		Acyclic:  true,
+	}, dag.Stats())
+	assert.Equal(t, dag.Depth(), dag.Stats().MaxDepth)
+
+	dag.AddEdge("4", "2")
+	stats := dag.Stats()
+	assert.False(t, stats.Acyclic)
+	assert.Equal(t, 0, stats.MaxDepth)
+	assert.Equal(t, 5, stats.Edges)
+	assert.Equal(t, 1, stats.Leaves)
+}
+
+func TestNode_ChildrenParents(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddNode("3")
+	dag.AddEdge("1", "3")
+	dag.AddEdge("2", "3")
+	dag.AddEdge("1", "2")
+
+	node := dag.GetNode("3")
+	assert.Equal(t, []*Node{dag.GetNode("1"), dag.GetNode("2")}, node.Parents())
+	assert.Equal(t, 0, len(node.Children()))
+	assert.Equal(t, []*Node{dag.GetNode("3"), dag.GetNode("2")}, dag.GetNode("1").Children())
+	assert.Equal(t, 0, len(dag.GetNode("1").Parents()))
+
+	// the returned slices are copies
+	node.Parents()[0] = nil
+	assert.Equal(t, dag.GetNode("1"), node.Parents()[0])
+
+	dag.Finalize()
+	assert.Equal(t, []*Node{dag.GetNode("1"), dag.GetNode("2")}, node.Parents())
+
+	built := dag.clone()
+	parents := built.GetNode("3").Parents()
+	assert.Equal(t, []*Node{built.GetNode("1"), built.GetNode("2")}, parents)
+
+	transposed := dag.Transpose()
+	assert.Equal(t, 2, len(transposed.GetNode("3").Children()))
+	assert.Equal(t, 2, len(transposed.GetNode("1").Parents()))
+
+	dag2 := NewDag()
+	msg, _ := dag.ToProto()
+	dag2.FromProto(msg)
+	assert.Equal(t, 2, len(dag2.GetNode(2).Parents()))
+}
+
+func TestDag_Prune(t *testing.T) {
+	dag := NewDag()
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		dag.AddNode(key)
+	}
+	// a -> b -> d -> f, a -> c -> d, c -> e, g alone
+	dag.AddEdge("a", "b")
+	dag.AddEdge("a", "c")
+	dag.AddEdge("b", "d")
+	dag.AddEdge("c", "d")
+	dag.AddEdge("c", "e")
+	dag.AddEdge("d", "f")
+
+	_, err := dag.Prune([]interface{}{"b", "x"})
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 7, dag.Len())
+
+	removed, err := dag.Prune([]interface{}{"b", "d"})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "d", "f"}, removed)
+	assert.Equal(t, 4, dag.Len())
+	assert.Nil(t, dag.GetNode("d"))
+	assert.Equal(t, []*Node{dag.GetNode("c")}, dag.GetNode("a").Children())
+	assert.Equal(t, []*Node{dag.GetNode("e")}, dag.GetNode("c").Children())
+	assert.Equal(t, 4, dag.GetNode("e").Index())
+
+	// the rest still runs
+	ran := make([]interface{}, 0)
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		ran = append(ran, node.key)
+		return nil
+	})
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, 4, len(ran))
+
+	removed, err = dag.Prune(nil)
+	assert.Nil(t, err)
+	assert.Empty(t, removed)
+}
+
+func TestDag_DeterministicOrder(t *testing.T) {
+	keys := []interface{}{"a", "b", "c", "d", "e", "f", "g", "h"}
+	edges := []Edge{{"a", "d"}, {"b", "d"}, {"c", "e"}, {"d", "f"}, {"e", "f"}, {"b", "g"}}
+	cycle := []Edge{{"f", "b"}, {"g", "c"}, {"h", "a"}, {"f", "h"}}
+
+	build := func(r *rand.Rand, edges []Edge) *Dag {
+		dag := NewDag()
+		for _, i := range r.Perm(len(keys)) {
+			dag.AddNode(keys[i])
+		}
+		for _, i := range r.Perm(len(edges)) {
+			dag.AddEdge(edges[i].From, edges[i].To)
+		}
+		return dag
+	}
+	nodeKeys := func(nodes []*Node) []interface{} {
+		ret := make([]interface{}, len(nodes))
+		for i, node := range nodes {
+			ret[i] = node.key
+		}
+		return ret
+	}
+
+	var expected []Edge
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		dag := build(r, edges)
+		assert.Equal(t, []interface{}{"a", "b", "c", "h"}, nodeKeys(dag.GetRootNodes()))
+		assert.Equal(t, []interface{}{"f", "g", "h"}, nodeKeys(dag.GetLeafNodes()))
+
+		sorted, err := dag.TopologicalSort()
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{"a", "b", "c", "d", "e", "f", "g", "h"}, nodeKeys(sorted))
+
+		generations, err := dag.Generations()
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(generations))
+		assert.Equal(t, []interface{}{"a", "b", "c", "h"}, nodeKeys(generations[0]))
+		assert.Equal(t, []interface{}{"d", "e", "g"}, nodeKeys(generations[1]))
+
+		order := make([]interface{}, 0)
+		dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+			order = append(order, node.key)
+			return nil
+		})
+		assert.Nil(t, dp.Run())
+		assert.Equal(t, []interface{}{"a", "b", "c", "h", "d", "g", "e", "f"}, order)
+
+		cyclic := build(r, append(append([]Edge{}, edges...), cycle...))
+		_, err = cyclic.TopologicalSort()
+		assert.Equal(t, ErrDagHasCirclular, err)
+		breaks, err := cyclic.SuggestCycleBreaks()
+		assert.Nil(t, err)
+		if expected == nil {
+			expected = breaks
+		}
+		assert.Equal(t, expected, breaks)
+	}
+}
+
+func TestDag_DeterministicOrderSamePrint(t *testing.T) {
+	// different keys printing the same are ordered by type, not by insertion
+	keys := []interface{}{"01", internedKey([]byte{0x01}), "1", int64(1), uint8(1)}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		dag := NewDag()
+		for _, j := range r.Perm(len(keys)) {
+			assert.Nil(t, dag.AddNode(keys[j]))
+		}
+		roots := make([]interface{}, 0)
+		for _, node := range dag.GetRootNodes() {
+			roots = append(roots, node.key)
+		}
+		assert.Equal(t, []interface{}{internedKey([]byte{0x01}), "01", int64(1), "1", uint8(1)}, roots)
+	}
+}
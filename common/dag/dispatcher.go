@@ -14,7 +14,10 @@
 package dag
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -27,6 +30,18 @@ import (
 // Callback func node
 type Callback func(*Node, interface{}) error
 
+// NodeStartHook is called on the worker goroutine right before the callback of the node
+type NodeStartHook func(*Node)
+
+// NodeFinishHook is called on the worker goroutine right after the callback of the node
+type NodeFinishHook func(*Node, error)
+
+// UndoCallback revert the effects of the callback of a completed node
+type UndoCallback func(*Node)
+
+// CompleteCallback is called once after all nodes completed successfully with the collected results
+type CompleteCallback func(results map[interface{}]interface{}) error
+
 // Task struct
 type Task struct {
 	dependence int
@@ -35,8 +50,14 @@ type Task struct {
 
 // Errors
 var (
-	ErrDagHasCirclular = errors.New("dag hava circlular")
-	ErrTimeout         = errors.New("dispatcher execute timeout")
+	ErrDagHasCirclular   = errors.New("dag hava circlular")
+	ErrTimeout           = errors.New("dispatcher execute timeout")
+	ErrInvalidCheckpoint = errors.New("checkpoint doesn't match the dag")
+	ErrAborted           = errors.New("dispatcher execute aborted")
+	ErrUnknownTask       = errors.New("dispatcher has no task for the node")
+	ErrTaskCompleted     = errors.New("dispatcher task already completed")
+	ErrTaskStarted       = errors.New("dispatcher task already started")
+	ErrStopped           = errors.New("dispatcher stopped before all nodes completed")
 )
 
 // Dispatcher struct a message dispatcher dag.
@@ -48,12 +69,48 @@ type Dispatcher struct {
 	elapseInMs       int64
 	quitCh           chan bool
 	queueCh          chan *Node
+	releaseCh        chan *Node
 	tasks            map[interface{}]*Task
 	queueCounter     int
 	completedCounter int
 	isFinsih         bool
 	finishCH         chan bool
+	abortCh          chan struct{}
+	doneCh           chan struct{}
 	context          interface{}
+	completed        map[interface{}]bool
+	started          map[interface{}]bool
+	cancelled        map[interface{}]bool
+	running          bool
+	clock            Clock
+	cpuClock         CPUClock
+	maxRetries       int
+	retryBackoff     time.Duration
+	onNodeStart      NodeStartHook
+	onNodeFinish     NodeFinishHook
+	muTimings        sync.Mutex
+	timings          map[interface{}]time.Duration
+	workers          map[interface{}]int
+	tracing          bool
+	trace            []*TraceEvent
+	muErr            sync.Mutex
+	err              error
+	muLoad           sync.Mutex
+	workerLoad       []int
+	muFailed         sync.Mutex
+	failed           []interface{}
+	muResults        sync.Mutex
+	results          map[interface{}]interface{}
+	onComplete       CompleteCallback
+	inline           bool
+	order            []interface{}
+	undo             UndoCallback
+	waitOnFailure    bool
+	evictResults     bool
+	consumers        map[interface{}]int
+	inflight         sync.WaitGroup
+	after            map[*Node][]*Node
+	before           map[*Node][]*Node
 }
 
 // NewDispatcher create Dag Dispatcher instance.
@@ -67,46 +124,562 @@ func NewDispatcher(dag *Dag, concurrency int, elapseInMs int64, context interfac
 		queueCounter:     0,
 		quitCh:           make(chan bool, concurrency),
 		queueCh:          make(chan *Node, dag.Len()),
+		releaseCh:        make(chan *Node, dag.Len()),
 		completedCounter: 0,
 		finishCH:         make(chan bool, 1),
+		abortCh:          make(chan struct{}, 1),
+		doneCh:           make(chan struct{}),
 		isFinsih:         false,
 		context:          context,
+		completed:        make(map[interface{}]bool),
+		started:          make(map[interface{}]bool),
+		cancelled:        make(map[interface{}]bool),
+		clock:            realClock{},
+		timings:          make(map[interface{}]time.Duration),
+		workers:          make(map[interface{}]int),
+		results:          make(map[interface{}]interface{}),
+		consumers:        make(map[interface{}]int),
 	}
 	return dp
 }
 
+// AbortCh return the channel to abort the dispatch, sending on or closing it
+// stops scheduling and Run returns ErrAborted
+func (dp *Dispatcher) AbortCh() chan<- struct{} {
+	return dp.abortCh
+}
+
+// SetClock replace the time source of the dispatcher, should be called before Run
+func (dp *Dispatcher) SetClock(clock Clock) {
+	dp.clock = clock
+}
+
+// Timings return the callback duration of each node whose callback has run, keyed by node key
+func (dp *Dispatcher) Timings() map[interface{}]time.Duration {
+	dp.muTimings.Lock()
+	defer dp.muTimings.Unlock()
+
+	timings := make(map[interface{}]time.Duration, len(dp.timings))
+	for key, d := range dp.timings {
+		timings[key] = d
+	}
+	return timings
+}
+
+// NodeWorkers return the index of the worker which ran the callback of each node, keyed by node key,
+// the indexes are the Worker of the trace events and the positions in WorkerLoad
+func (dp *Dispatcher) NodeWorkers() map[interface{}]int {
+	dp.muTimings.Lock()
+	defer dp.muTimings.Unlock()
+
+	workers := make(map[interface{}]int, len(dp.workers))
+	for key, worker := range dp.workers {
+		workers[key] = worker
+	}
+	return workers
+}
+
+// SetResult record the result of the node, usually called in the callback
+func (dp *Dispatcher) SetResult(node *Node, result interface{}) {
+	dp.muResults.Lock()
+	defer dp.muResults.Unlock()
+
+	dp.results[node.key] = result
+}
+
+// Results return the collected results keyed by node key
+func (dp *Dispatcher) Results() map[interface{}]interface{} {
+	dp.muResults.Lock()
+	defer dp.muResults.Unlock()
+
+	results := make(map[interface{}]interface{}, len(dp.results))
+	for key, result := range dp.results {
+		results[key] = result
+	}
+	return results
+}
+
+// ParentResults return the results of the parents of the node keyed by node key,
+// parents without a result are left out
+func (dp *Dispatcher) ParentResults(node *Node) map[interface{}]interface{} {
+	dp.muResults.Lock()
+	defer dp.muResults.Unlock()
+
+	results := make(map[interface{}]interface{}, len(node.parents))
+	for _, parent := range node.parents {
+		if result, ok := dp.results[parent.key]; ok {
+			results[parent.key] = result
+		}
+	}
+	return results
+}
+
+// SetEvictResults make the dispatcher drop the result of a node once all its children
+// completed or were cancelled, so only the results still needed are held in memory.
+// The results of the nodes without children are kept till the end. It's disabled by default,
+// Results and the reduce step then see the results of all nodes.
+func (dp *Dispatcher) SetEvictResults(evict bool) {
+	dp.evictResults = evict
+}
+
+// consume count down the children of the parent yet to consume its result, the result
+// is evicted after the last one if the parent completed, must be called with muTask held
+func (dp *Dispatcher) consume(parent *Node) {
+	left, ok := dp.consumers[parent.key]
+	if !ok {
+		left = len(parent.children)
+	}
+	left--
+	dp.consumers[parent.key] = left
+	if left == 0 && dp.completed[parent.key] {
+		dp.evictResult(parent.key)
+	}
+}
+
+func (dp *Dispatcher) evictResult(key interface{}) {
+	dp.muResults.Lock()
+	defer dp.muResults.Unlock()
+	delete(dp.results, key)
+}
+
+// SetOnComplete set the optional reduce step, it's called exactly once after
+// all nodes completed successfully, and not at all if the dispatch failed
+func (dp *Dispatcher) SetOnComplete(onComplete CompleteCallback) {
+	dp.onComplete = onComplete
+}
+
+// SetInline make a single worker dispatch run the callbacks on the goroutine calling Run
+// instead of a spawned worker, which keeps the stack traces and debugging of the callbacks simple.
+// It has no effect when concurrency is greater than 1. A timeout or abort can't interrupt
+// a running callback inline, Run returns after the callback.
+func (dp *Dispatcher) SetInline(inline bool) {
+	dp.inline = inline
+}
+
+// SetUndo make the dispatch all-or-nothing, when Run fails undo is called for every node
+// completed in this Run in the reverse completion order, so a node is undone before its parents.
+// The undo pass runs on the goroutine calling Run after the running callbacks returned,
+// nodes completed before a checkpoint was restored are not undone.
+func (dp *Dispatcher) SetUndo(undo UndoCallback) {
+	dp.undo = undo
+}
+
+// CompletedOrder return the keys of the nodes completed in this Run in completion order
+func (dp *Dispatcher) CompletedOrder() []interface{} {
+	dp.muTask.Lock()
+	defer dp.muTask.Unlock()
+
+	order := make([]interface{}, len(dp.order))
+	copy(order, dp.order)
+	return order
+}
+
+// SetWaitOnFailure make a failed Run return only after the running callbacks returned, so
+// Results, CompletedOrder, Timings and NodeWorkers hold the final data of the nodes that
+// finished. No node starts after the failure, but a hung callback delays Run past the timeout.
+func (dp *Dispatcher) SetWaitOnFailure(wait bool) {
+	dp.waitOnFailure = wait
+}
+
+// settle wait for the running callbacks of a failed dispatch if needed
+func (dp *Dispatcher) settle() {
+	if dp.waitOnFailure || dp.undo != nil {
+		dp.inflight.Wait()
+	}
+}
+
+// rollback undo the completed nodes in the reverse completion order
+func (dp *Dispatcher) rollback() {
+	if dp.undo == nil {
+		return
+	}
+	order := dp.CompletedOrder()
+	for i := len(order) - 1; i >= 0; i-- {
+		dp.undo(dp.dag.GetNode(order[i]))
+	}
+}
+
+// SetLifecycleHooks set the optional hooks around the callback of each node, nil is allowed
+func (dp *Dispatcher) SetLifecycleHooks(onStart NodeStartHook, onFinish NodeFinishHook) {
+	dp.onNodeStart = onStart
+	dp.onNodeFinish = onFinish
+}
+
+// checkpoint is the saved state of a dispatcher, nodes are identified by index
+type checkpoint struct {
+	Dependences map[int]int `json:"dependences"`
+	Completed   []int       `json:"completed"`
+}
+
+// Checkpoint save the dependence counters and completed nodes of the dispatcher,
+// use RestoreDispatcher to resume the dispatch later. The counters don't include
+// the constraints, see SetConstraints.
+func (dp *Dispatcher) Checkpoint() ([]byte, error) {
+	dp.muTask.Lock()
+	defer dp.muTask.Unlock()
+
+	cp := &checkpoint{
+		Dependences: make(map[int]int),
+		Completed:   make([]int, 0),
+	}
+	for _, node := range dp.dag.GetNodes() {
+		dependence := node.parentCounter
+		if task, ok := dp.tasks[node.key]; ok {
+			dependence = task.dependence - dp.pendingBefore(dp.before[node])
+		}
+		cp.Dependences[node.index] = dependence
+		if dp.completed[node.key] {
+			cp.Completed = append(cp.Completed, node.index)
+		}
+	}
+	return json.Marshal(cp)
+}
+
+// RestoreDispatcher create Dag Dispatcher instance from a checkpoint,
+// completed nodes won't be executed again when running.
+func RestoreDispatcher(dag *Dag, concurrency int, elapseInMs int64, context interface{}, cb Callback, data []byte) (*Dispatcher, error) {
+	cp := new(checkpoint)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	if len(cp.Dependences) != dag.Len() {
+		return nil, ErrInvalidCheckpoint
+	}
+
+	dp := NewDispatcher(dag, concurrency, elapseInMs, context, cb)
+	for idx, dependence := range cp.Dependences {
+		key, ok := dag.indexs[idx]
+		if !ok {
+			return nil, ErrInvalidCheckpoint
+		}
+		dp.tasks[key] = &Task{
+			dependence: dependence,
+			node:       dag.GetNode(key),
+		}
+	}
+	for _, idx := range cp.Completed {
+		key, ok := dag.indexs[idx]
+		if !ok {
+			return nil, ErrInvalidCheckpoint
+		}
+		dp.completed[key] = true
+	}
+	dp.queueCounter = len(dp.completed)
+	dp.completedCounter = len(dp.completed)
+	return dp, nil
+}
+
+// UnreachableError is returned by DryRun with the keys of the nodes that would never be dispatched
+type UnreachableError struct {
+	Keys []interface{}
+	Err  error
+}
+
+func (e *UnreachableError) Error() string {
+	return e.Err.Error() + ": unreachable nodes " + fmt.Sprint(e.Keys)
+}
+
+// DryRun simulate the dependence resolution of Run without calling any callback,
+// return an *UnreachableError if some nodes would never be dispatched.
+func (dp *Dispatcher) DryRun() error {
+	dependence := make(map[interface{}]int, dp.dag.Len())
+	queue := make([]*Node, 0)
+	for _, node := range dp.dag.GetNodes() {
+		dependence[node.key] = dp.initialDependence(node)
+		if task, ok := dp.tasks[node.key]; ok {
+			dependence[node.key] = task.dependence
+		}
+		if !dp.completed[node.key] && dependence[node.key] == 0 {
+			queue = append(queue, node)
+		}
+	}
+
+	reached := make(map[interface{}]bool, dp.dag.Len())
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		reached[node.key] = true
+		for _, children := range [][]*Node{node.children, dp.after[node]} {
+			for _, child := range children {
+				dependence[child.key]--
+				if dependence[child.key] == 0 && !dp.completed[child.key] {
+					queue = append(queue, child)
+				}
+			}
+		}
+	}
+
+	keys := make([]interface{}, 0)
+	for i := 0; i <= dp.dag.index; i++ {
+		key, ok := dp.dag.indexs[i]
+		if !ok || reached[key] || dp.completed[key] {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	err := dp.dag.Validate()
+	if err == nil {
+		// the dag itself is fine, the restored dependence counters are not
+		err = ErrInvalidCheckpoint
+	}
+	return &UnreachableError{Keys: keys, Err: err}
+}
+
+// Result summarize a dispatch
+type Result struct {
+	Total      int
+	Completed  int
+	Skipped    int
+	FailedKeys []interface{}
+	Elapsed    time.Duration
+	// Utilization is the share of the workers' wall time spent on cpu, 0 without a CPUClock
+	Utilization float64
+	Err         error
+}
+
 // Run dag dispatch goroutine.
 func (dp *Dispatcher) Run() error {
-	logging.VLog().Debug("Starting Dag Dispatcher...")
+	return dp.RunSummary().Err
+}
 
-	vertices := dp.dag.GetNodes()
+// Start dispatch the dag in the background and return at once, the returned channel
+// receives the error of the dispatch, nil on success, and is closed afterwards.
+// Use Progress to follow the dispatch, AbortCh to fail it with ErrAborted,
+// or Stop to end it early with ErrStopped.
+func (dp *Dispatcher) Start() <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- dp.Run()
+		close(errCh)
+	}()
+	return errCh
+}
 
+// Progress return the number of completed nodes, including the ones restored
+// from a checkpoint, and the number of nodes of the dag
+func (dp *Dispatcher) Progress() (int, int) {
+	dp.muTask.Lock()
+	defer dp.muTask.Unlock()
+	return len(dp.completed), dp.dag.Len()
+}
+
+// RunSummary dispatch the dag and return the summary of the dispatch,
+// nodes already completed by a restored checkpoint are counted as skipped
+func (dp *Dispatcher) RunSummary() *Result {
+	dp.muTask.Lock()
+	skipped := len(dp.completed)
+	dp.muTask.Unlock()
+
+	var cpuStart time.Duration
+	if dp.cpuClock != nil {
+		cpuStart = dp.cpuClock()
+	}
+	start := dp.clock.Now()
+	err := dp.run()
+	elapsed := dp.clock.Now().Sub(start)
+
+	util := 0.0
+	if dp.cpuClock != nil {
+		util = utilization(dp.cpuClock()-cpuStart, elapsed, dp.concurrency)
+	}
+
+	dp.muTask.Lock()
+	completed := len(dp.completed) - skipped
+	dp.muTask.Unlock()
+
+	dp.muFailed.Lock()
+	failed := make([]interface{}, len(dp.failed))
+	copy(failed, dp.failed)
+	dp.muFailed.Unlock()
+
+	return &Result{
+		Total:       dp.dag.Len(),
+		Completed:   completed,
+		Skipped:     skipped,
+		FailedKeys:  failed,
+		Elapsed:     elapsed,
+		Utilization: util,
+		Err:         err,
+	}
+}
+
+func (dp *Dispatcher) run() error {
+	logging.VLog().WithFields(logrus.Fields{
+		"size":        dp.dag.Len(),
+		"concurrency": dp.concurrency,
+		"completed":   len(dp.completed),
+	}).Debug("Starting Dag Dispatcher...")
+
+	// an empty dag is a trivial success
+	if dp.dag.Len() == 0 {
+		return dp.complete()
+	}
+
+	select {
+	case <-dp.abortCh:
+		return ErrAborted
+	default:
+	}
+
+	dp.muTask.Lock()
+	dp.initTasks()
+	dp.running = true
+	// GetNodes follows the map order, the roots are queued by key to keep the dispatch reproducible
+	vertices := dp.dag.GetNodes()
+	sortNodes(vertices)
 	rootCounter := 0
 	for _, node := range vertices {
-		task := &Task{
-			dependence: node.parentCounter,
-			node:       node,
+		if dp.completed[node.key] || dp.cancelled[node.key] {
+			continue
 		}
-		task.dependence = node.parentCounter
-		dp.tasks[node.key] = task
-
-		if task.dependence == 0 {
+		if dp.tasks[node.key].dependence == 0 {
 			rootCounter++
 			dp.push(node)
 		}
 	}
+	finished := len(dp.completed) + len(dp.cancelled)
+	dp.muTask.Unlock()
 
-	if rootCounter == 0 && len(vertices) > 0 {
+	if rootCounter == 0 && len(vertices) > finished {
 		return ErrDagHasCirclular
 	}
+	if len(vertices) > 0 && len(vertices) == finished {
+		return nil
+	}
+
+	if err := dp.execute(); err != nil {
+		dp.settle()
+		dp.rollback()
+		return err
+	}
+	if err := dp.complete(); err != nil {
+		dp.rollback()
+		return err
+	}
+	return nil
+}
 
-	return dp.execute()
+// initTasks create the missing tasks of the dag nodes
+func (dp *Dispatcher) initTasks() {
+	for _, node := range dp.dag.GetNodes() {
+		if _, ok := dp.tasks[node.key]; !ok {
+			dp.tasks[node.key] = &Task{
+				dependence: dp.initialDependence(node),
+				node:       node,
+			}
+		}
+	}
+}
+
+// Cancel remove the node from scheduling if it hasn't started, it can be called before or during Run.
+// Descendants depending only on cancelled nodes are cancelled as well, other dependents
+// no longer wait for the node and are dispatched once their remaining parents complete.
+// A node already handed to a worker is left to finish and ErrTaskStarted is returned.
+// Cancelling the last pending nodes of a running dispatch ends it as Stop does.
+func (dp *Dispatcher) Cancel(key interface{}) error {
+	dp.muTask.Lock()
+	dp.initTasks()
+	key = dp.dag.keyOf(key)
+	task, ok := dp.tasks[key]
+	if !ok {
+		dp.muTask.Unlock()
+		return ErrUnknownTask
+	}
+	if dp.started[key] || dp.completed[key] {
+		dp.muTask.Unlock()
+		return ErrTaskStarted
+	}
+	if !dp.cancelled[key] {
+		dp.cancel(task)
+	}
+	// cancelling the last pending nodes stops the dispatch
+	isFinish := dp.running && dp.completedCounter == dp.queueCounter &&
+		dp.queueCounter == dp.dag.Len()-len(dp.cancelled)
+	dp.muTask.Unlock()
+
+	if isFinish {
+		dp.Stop()
+	}
+	return nil
+}
+
+// cancel the task and its exclusive descendants, must be called with muTask held
+func (dp *Dispatcher) cancel(task *Task) {
+	key := task.node.key
+	dp.cancelled[key] = true
+	if dp.evictResults {
+		for _, parent := range task.node.parents {
+			dp.consume(parent)
+		}
+	}
+	if dp.running && task.dependence == 0 {
+		// the node is in the queue, it won't be executed
+		dp.queueCounter--
+	}
+
+	for _, child := range sortedChildren(task.node) {
+		if dp.cancelled[child.key] {
+			continue
+		}
+		if dp.allParentsCancelled(child) {
+			dp.cancel(dp.tasks[child.key])
+			continue
+		}
+		childTask := dp.tasks[child.key]
+		childTask.dependence--
+		if childTask.dependence == 0 && dp.running {
+			dp.push(childTask.node)
+		}
+	}
+	// the nodes ordered after it by a constraint no longer wait for it
+	for _, next := range dp.after[task.node] {
+		if dp.cancelled[next.key] {
+			continue
+		}
+		nextTask := dp.tasks[next.key]
+		nextTask.dependence--
+		if nextTask.dependence == 0 && dp.running {
+			dp.push(nextTask.node)
+		}
+	}
+}
+
+// allParentsCancelled return whether every parent of the node is cancelled
+func (dp *Dispatcher) allParentsCancelled(node *Node) bool {
+	for _, parent := range node.parents {
+		if !dp.cancelled[parent.key] {
+			return false
+		}
+	}
+	return true
+}
+
+// start mark the node handed to a worker, return false if the node is cancelled or the dispatch stopped
+func (dp *Dispatcher) start(node *Node) bool {
+	dp.muTask.Lock()
+	defer dp.muTask.Unlock()
+	if dp.cancelled[node.key] || dp.isFinsih {
+		return false
+	}
+	dp.started[node.key] = true
+	dp.inflight.Add(1)
+	return true
+}
+
+// complete run the reduce step with the collected results
+func (dp *Dispatcher) complete() error {
+	if dp.onComplete == nil {
+		return nil
+	}
+	return dp.onComplete(dp.Results())
 }
 
 // execute callback
 func (dp *Dispatcher) execute() error {
-	logging.VLog().Debug("loop Dag Dispatcher.")
-
 	//timerChan := time.NewTicker(time.Second).C
 
 	if dp.dag.Len() < dp.concurrency {
@@ -116,65 +689,260 @@ func (dp *Dispatcher) execute() error {
 		return nil
 	}
 
-	var err error
-	go func() {
-		for i := 0; i < dp.concurrency; i++ {
-			go func() {
-				for {
-					select {
-					case <-dp.quitCh:
-						logging.VLog().Debug("Stoped Dag Dispatcher.")
-						return
-					case msg := <-dp.queueCh:
-						err = dp.cb(msg, dp.context)
-
-						if err != nil {
-							dp.Stop()
-						} else {
-							isFinish, err := dp.onCompleteParentTask(msg)
-							if err != nil {
-								logging.VLog().WithFields(logrus.Fields{
-									"err": err,
-								}).Debug("Stoped Dag Dispatcher.")
-								dp.Stop()
-							}
-							if isFinish {
-								dp.Stop()
-							}
+	logging.VLog().WithFields(logrus.Fields{
+		"size":        dp.dag.Len(),
+		"concurrency": dp.concurrency,
+		"elapseInMs":  dp.elapseInMs,
+		"roots":       dp.queueCounter - dp.completedCounter,
+	}).Debug("Dispatching Dag nodes.")
+
+	dp.muLoad.Lock()
+	dp.workerLoad = make([]int, dp.concurrency)
+	dp.muLoad.Unlock()
+
+	if dp.inline && dp.concurrency == 1 {
+		go dp.watch()
+		dp.runInline()
+	} else {
+		// idle workers queue up their node channels, ready nodes are handed to
+		// the longest waiting worker so that the load is spread round-robin
+		idleCh := make(chan chan *Node, dp.concurrency)
+		go dp.schedule(idleCh)
+
+		go func() {
+			for i := 0; i < dp.concurrency; i++ {
+				go func(id int) {
+					nodeCh := make(chan *Node, 1)
+					for {
+						idleCh <- nodeCh
+						select {
+						case <-dp.quitCh:
+							logging.VLog().Debug("Stoped Dag Dispatcher.")
+							return
+						case msg := <-nodeCh:
+							dp.runNode(id, msg)
 						}
 					}
-				}
-			}()
+				}(i)
+			}
+			dp.watch()
+		}()
+	}
+
+	<-dp.finishCH
+	dp.muErr.Lock()
+	defer dp.muErr.Unlock()
+	return dp.err
+}
+
+// runInline execute the ready nodes one by one on the calling goroutine until the dispatch stops
+func (dp *Dispatcher) runInline() {
+	for {
+		// a stopped dispatch must not take another node
+		select {
+		case <-dp.doneCh:
+			return
+		default:
+		}
+		select {
+		case <-dp.doneCh:
+			return
+		case msg := <-dp.queueCh:
+			dp.runNode(0, msg)
 		}
+	}
+}
+
+// runNode execute the node on the worker and dispatch its children, the dispatch
+// is stopped when the node fails or is the last one
+func (dp *Dispatcher) runNode(worker int, msg *Node) {
+	if !dp.start(msg) {
+		dp.release(msg)
+		return
+	}
+	defer dp.inflight.Done()
+	dp.muLoad.Lock()
+	dp.workerLoad[worker]++
+	dp.muLoad.Unlock()
+	err := dp.invoke(worker, msg)
+	dp.release(msg)
+	if err != nil {
+		dp.fail(err)
+		dp.finish()
+		return
+	}
+	isFinish, err := dp.onCompleteParentTask(msg)
+	if err != nil {
+		logging.VLog().WithFields(logrus.Fields{
+			"err": err,
+		}).Debug("Stoped Dag Dispatcher.")
+		dp.fail(err)
+		dp.finish()
+	} else if isFinish {
+		dp.finish()
+	}
+}
+
+// watch stop the dispatch on the deadline or an abort, it returns once the dispatch is done
+func (dp *Dispatcher) watch() {
+	var deadlineCh <-chan time.Time
+	if dp.elapseInMs > 0 {
+		deadlineCh = dp.clock.After(time.Duration(dp.elapseInMs) * time.Millisecond)
+	}
+	select {
+	case <-deadlineCh:
+		dp.fail(ErrTimeout)
+		dp.finish()
+	case <-dp.abortCh:
+		dp.fail(ErrAborted)
+		dp.finish()
+	case <-dp.doneCh:
+	}
+}
 
-		if dp.elapseInMs > 0 {
-			deadlineTimer := time.NewTimer(time.Duration(dp.elapseInMs) * time.Millisecond)
-			<-deadlineTimer.C
-			err = ErrTimeout
-			dp.Stop()
+// fail record the error of the dispatch, only the first error is kept
+func (dp *Dispatcher) fail(err error) {
+	dp.muErr.Lock()
+	defer dp.muErr.Unlock()
+	if dp.err == nil {
+		dp.err = err
+	}
+}
+
+// schedule hand the ready nodes to the idle workers in the order they became idle,
+// a node waits while another node of its exclusion group is running
+func (dp *Dispatcher) schedule(idleCh chan chan *Node) {
+	ready := make([]*Node, 0)
+	running := make(map[string]bool)
+	waiting := make(map[string][]*Node)
+	for {
+		var idle chan chan *Node
+		if len(ready) > 0 {
+			idle = idleCh
 		}
-	}()
+		select {
+		case <-dp.doneCh:
+			return
+		case msg := <-dp.queueCh:
+			if msg.group == "" {
+				ready = append(ready, msg)
+			} else if running[msg.group] {
+				waiting[msg.group] = append(waiting[msg.group], msg)
+			} else {
+				running[msg.group] = true
+				ready = append(ready, msg)
+			}
+		case msg := <-dp.releaseCh:
+			if next := waiting[msg.group]; len(next) > 0 {
+				ready = append(ready, next[0])
+				waiting[msg.group] = next[1:]
+			} else {
+				delete(running, msg.group)
+			}
+		case nodeCh := <-idle:
+			nodeCh <- ready[0]
+			ready = ready[1:]
+		}
+	}
+}
 
-	<-dp.finishCH
+// release let the next node of the exclusion group of the finished node run
+func (dp *Dispatcher) release(node *Node) {
+	if node.group != "" {
+		dp.releaseCh <- node
+	}
+}
+
+// WorkerLoad return the number of nodes executed by each worker in the last Run
+func (dp *Dispatcher) WorkerLoad() []int {
+	dp.muLoad.Lock()
+	defer dp.muLoad.Unlock()
+	load := make([]int, len(dp.workerLoad))
+	copy(load, dp.workerLoad)
+	return load
+}
+
+// invoke the callback of the node between the lifecycle hooks
+func (dp *Dispatcher) invoke(worker int, node *Node) error {
+	if dp.onNodeStart != nil {
+		dp.onNodeStart(node)
+	}
+	start := dp.clock.Now()
+	err := dp.callWithRetry(node)
+	end := dp.clock.Now()
+	dp.muTimings.Lock()
+	dp.timings[node.key] = end.Sub(start)
+	dp.workers[node.key] = worker
+	if dp.tracing {
+		dp.trace = append(dp.trace, &TraceEvent{Key: node.key, Worker: worker, Start: start, End: end})
+	}
+	dp.muTimings.Unlock()
+	if err != nil {
+		dp.muFailed.Lock()
+		dp.failed = append(dp.failed, node.key)
+		dp.muFailed.Unlock()
+	}
+	if dp.onNodeFinish != nil {
+		dp.onNodeFinish(node, err)
+	}
+	return err
+}
+
+// call the callback of the node, start and complete events
+// are only logged when debug level is enabled
+func (dp *Dispatcher) call(node *Node) error {
+	if logging.VLog().Level < logrus.DebugLevel {
+		return dp.cb(node, dp.context)
+	}
+
+	logging.VLog().WithFields(logrus.Fields{
+		"key":   node.key,
+		"index": node.index,
+	}).Debug("Dag node started.")
+
+	start := dp.clock.Now()
+	err := dp.cb(node, dp.context)
+
+	logging.VLog().WithFields(logrus.Fields{
+		"key":      node.key,
+		"index":    node.index,
+		"duration": dp.clock.Now().Sub(start),
+		"err":      err,
+	}).Debug("Dag node completed.")
 	return err
 }
 
-// Stop stop goroutine.
+// Stop end the dispatch early, the nodes running are left to finish and no other node
+// is started. Run then returns ErrStopped and the CompleteCallback isn't called.
+// Stop has no effect on a dispatch already finished.
 func (dp *Dispatcher) Stop() {
-	logging.VLog().Debug("Stopping dag Dispatcher...")
 	dp.muTask.Lock()
 	defer dp.muTask.Unlock()
 	if dp.isFinsih {
 		return
 	}
-	dp.isFinsih = true
+	dp.fail(ErrStopped)
+	dp.stop()
+}
 
-	for i := 0; i < dp.concurrency; i++ {
-		select {
-		case dp.quitCh <- true:
-		default:
-		}
+// finish end the dispatch, with the error recorded by fail if any
+func (dp *Dispatcher) finish() {
+	dp.muTask.Lock()
+	defer dp.muTask.Unlock()
+	if dp.isFinsih {
+		return
 	}
+	dp.stop()
+}
+
+// stop goroutine, must be called with muTask held
+func (dp *Dispatcher) stop() {
+	logging.VLog().Debug("Stopping dag Dispatcher...")
+	dp.isFinsih = true
+	close(dp.doneCh)
+
+	// closing quitCh reaches every worker, including those started after Stop
+	close(dp.quitCh)
 	dp.finishCH <- true
 }
 
@@ -190,19 +958,64 @@ func (dp *Dispatcher) onCompleteParentTask(node *Node) (bool, error) {
 	defer dp.muTask.Unlock()
 
 	key := node.key
+	if _, ok := dp.tasks[key]; !ok {
+		logging.VLog().WithFields(logrus.Fields{
+			"key": key,
+		}).Error("Completed an unknown Dag task.")
+		return false, ErrUnknownTask
+	}
+	if dp.completed[key] {
+		logging.VLog().WithFields(logrus.Fields{
+			"key": key,
+		}).Error("Completed a Dag task twice.")
+		return false, ErrTaskCompleted
+	}
 
-	vertices := dp.dag.GetChildrenNodes(key)
-	for _, node := range vertices {
+	for _, node := range sortedChildren(node) {
 		err := dp.updateDependenceTask(node.key)
 		if err != nil {
 			return false, err
 		}
 	}
+	for _, next := range dp.after[node] {
+		if err := dp.updateDependenceTask(next.key); err != nil {
+			return false, err
+		}
+	}
 
+	dp.completed[key] = true
+	dp.order = append(dp.order, key)
+	if dp.evictResults {
+		for _, parent := range node.parents {
+			dp.consume(parent)
+		}
+		// every child was cancelled before the node completed
+		if left, ok := dp.consumers[key]; ok && left == 0 {
+			dp.evictResult(key)
+		}
+	}
 	dp.completedCounter++
+	// the counter must agree with the completed set, otherwise the finish condition may never be met
+	if dp.completedCounter != len(dp.completed) {
+		logging.VLog().WithFields(logrus.Fields{
+			"counter":   dp.completedCounter,
+			"completed": len(dp.completed),
+		}).Error("Reconciled Dag completed counter.")
+		dp.completedCounter = len(dp.completed)
+	}
+
+	if logging.VLog().Level >= logrus.DebugLevel {
+		logging.VLog().WithFields(logrus.Fields{
+			"key":       key,
+			"children":  len(node.children),
+			"completed": dp.completedCounter,
+			"queued":    dp.queueCounter,
+			"size":      dp.dag.Len(),
+		}).Debug("Completed Dag parent task.")
+	}
 
 	if dp.completedCounter == dp.queueCounter {
-		if dp.queueCounter < dp.dag.Len() {
+		if dp.queueCounter < dp.dag.Len()-len(dp.cancelled) {
 			return false, ErrDagHasCirclular
 		}
 		return true, nil
@@ -213,13 +1026,140 @@ func (dp *Dispatcher) onCompleteParentTask(node *Node) (bool, error) {
 
 // updateDependenceTask task counter
 func (dp *Dispatcher) updateDependenceTask(key interface{}) error {
-	if _, ok := dp.tasks[key]; ok {
-		dp.tasks[key].dependence--
-		if dp.tasks[key].dependence == 0 {
-			dp.push(dp.tasks[key].node)
+	task, ok := dp.tasks[key]
+	if !ok {
+		logging.VLog().WithFields(logrus.Fields{
+			"key": key,
+		}).Error("Updated an unknown Dag task.")
+		return ErrUnknownTask
+	}
+	if dp.cancelled[key] {
+		return nil
+	}
+	task.dependence--
+	if task.dependence == 0 {
+		dp.push(task.node)
+	}
+	if task.dependence < 0 {
+		return ErrDagHasCirclular
+	}
+	return nil
+}
+
+// DagError is the error of one dag in RunAll
+type DagError struct {
+	Index int
+	Err   error
+}
+
+func (e *DagError) Error() string {
+	return "dag " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+// RunAll dispatch independent dags on a single pool of concurrency workers taking
+// the ready nodes of all dags, roots are queued dag by dag in key order.
+// Exclusion groups apply within each dag. A failed dag stops dispatching its own nodes
+// while the other dags go on, the *DagError of the first failed dag in dags is returned.
+func RunAll(dags []*Dag, concurrency int, cb Callback) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	type task struct {
+		dag  int
+		node *Node
+	}
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+	ready := make([]task, 0)
+	dependence := make(map[*Node]int)
+	completed := make([]int, len(dags))
+	errs := make([]error, len(dags))
+	groups := make([]map[string]bool, len(dags))
+	for i, dag := range dags {
+		groups[i] = make(map[string]bool)
+		for _, node := range dag.GetRootNodes() {
+			ready = append(ready, task{dag: i, node: node})
+		}
+		for _, node := range dag.nodes {
+			dependence[node] = node.parentCounter
 		}
-		if dp.tasks[key].dependence < 0 {
-			return ErrDagHasCirclular
+	}
+
+	// next take the first ready node whose exclusion group is free, must be called with mu held
+	next := func() (task, bool) {
+		for i := 0; i < len(ready); {
+			t := ready[i]
+			if errs[t.dag] != nil {
+				ready = append(ready[:i], ready[i+1:]...)
+				continue
+			}
+			if t.node.group != "" && groups[t.dag][t.node.group] {
+				i++
+				continue
+			}
+			ready = append(ready[:i], ready[i+1:]...)
+			return t, true
+		}
+		return task{}, false
+	}
+
+	running := 0
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			for {
+				t, ok := next()
+				if !ok {
+					// nothing runs, so no node can become ready anymore
+					if running == 0 {
+						cond.Broadcast()
+						return
+					}
+					cond.Wait()
+					continue
+				}
+				running++
+				if t.node.group != "" {
+					groups[t.dag][t.node.group] = true
+				}
+				mu.Unlock()
+				err := cb(t.node, nil)
+				mu.Lock()
+				running--
+				if t.node.group != "" {
+					delete(groups[t.dag], t.node.group)
+				}
+				if err != nil {
+					if errs[t.dag] == nil {
+						errs[t.dag] = err
+					}
+				} else if errs[t.dag] == nil {
+					completed[t.dag]++
+					for _, child := range sortedChildren(t.node) {
+						dependence[child]--
+						if dependence[child] == 0 {
+							ready = append(ready, task{dag: t.dag, node: child})
+						}
+					}
+				}
+				cond.Broadcast()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil && completed[i] < dags[i].Len() {
+			// the nodes left wait on each other
+			err = ErrDagHasCirclular
+		}
+		if err != nil {
+			return &DagError{Index: i, Err: err}
 		}
 	}
 	return nil
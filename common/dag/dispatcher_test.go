@@ -18,6 +18,10 @@ import (
 	"flag"
 	"fmt"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -158,3 +162,987 @@ func TestDispatcher_Start1(t *testing.T) {
 	err = dp3.Run()
 	assert.NotNil(t, err)
 }
+
+func TestDispatcher_CheckpointRestore(t *testing.T) {
+	dag := NewDag()
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys {
+		dag.AddNode(key)
+	}
+	dag.AddEdge("a", "b")
+	dag.AddEdge("b", "c")
+	dag.AddEdge("c", "d")
+	dag.AddEdge("a", "e")
+
+	executed := make(map[interface{}]bool)
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		if node.key == "c" {
+			return errors.New("interrupted")
+		}
+		executed[node.key] = true
+		return nil
+	})
+	assert.NotNil(t, dp.Run())
+
+	data, err := dp.Checkpoint()
+	assert.Nil(t, err)
+
+	_, err = RestoreDispatcher(NewDag(), 1, 0, nil, nil, data)
+	assert.Equal(t, ErrInvalidCheckpoint, err)
+
+	resumed := make(map[interface{}]bool)
+	dp, err = RestoreDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		assert.False(t, executed[node.key])
+		resumed[node.key] = true
+		return nil
+	}, data)
+	assert.Nil(t, err)
+	assert.Nil(t, dp.Run())
+	assert.True(t, resumed["c"])
+	assert.True(t, resumed["d"])
+	assert.Equal(t, len(keys), len(executed)+len(resumed))
+
+	// a checkpoint of a finished dispatch runs nothing
+	data, err = dp.Checkpoint()
+	assert.Nil(t, err)
+	dp, err = RestoreDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		return errors.New("should not be executed")
+	}, data)
+	assert.Nil(t, err)
+	assert.Nil(t, dp.Run())
+}
+
+type fakeClock struct {
+	now     time.Time
+	afterCh chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.afterCh
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	c.afterCh <- c.now
+}
+
+func TestDispatcher_Clock(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+
+	clock := &fakeClock{afterCh: make(chan time.Time, 1)}
+	blockCh := make(chan bool)
+	dp := NewDispatcher(dag, 1, 1000*1000, nil, func(node *Node, context interface{}) error {
+		<-blockCh
+		return nil
+	})
+	dp.SetClock(clock)
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, ErrTimeout, dp.Run())
+	close(blockCh)
+}
+
+func TestRunAll(t *testing.T) {
+	dags := make([]*Dag, 5)
+	for i := range dags {
+		dag := NewDag()
+		for j := 0; j < 10; j++ {
+			dag.AddNode(j)
+		}
+		for j := 1; j < 10; j++ {
+			dag.AddEdge(0, j)
+		}
+		dags[i] = dag
+	}
+
+	var mu sync.Mutex
+	running, maxRunning, executed := 0, 0, 0
+	workers := make(map[string]bool)
+	before, maxGoroutines := runtime.NumGoroutine(), 0
+	err := RunAll(dags, 3, func(node *Node, context interface{}) error {
+		mu.Lock()
+		running++
+		executed++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		workers[goroutineID()] = true
+		if n := runtime.NumGoroutine(); n > maxGoroutines {
+			maxGoroutines = n
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond * 5)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 50, executed)
+	assert.True(t, maxRunning <= 3)
+	// one pool of workers for all the dags
+	assert.True(t, len(workers) <= 3)
+	assert.True(t, maxGoroutines-before <= 3)
+
+	failed := NewDag()
+	failed.AddNode("x")
+	err = RunAll([]*Dag{dags[0], failed}, 2, func(node *Node, context interface{}) error {
+		if node.key == "x" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	dagErr, ok := err.(*DagError)
+	assert.True(t, ok)
+	assert.Equal(t, 1, dagErr.Index)
+
+	cyclic := NewDag()
+	cyclic.AddNode("a")
+	cyclic.AddNode("b")
+	cyclic.AddNode("c")
+	cyclic.AddEdge("a", "b")
+	cyclic.AddEdge("b", "c")
+	cyclic.AddEdge("c", "b")
+	err = RunAll([]*Dag{dags[0], cyclic}, 2, func(node *Node, context interface{}) error {
+		return nil
+	})
+	assert.Equal(t, &DagError{Index: 1, Err: ErrDagHasCirclular}, err)
+}
+
+func TestDispatcher_LifecycleHooks(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("1")
+	dag.AddNode("2")
+	dag.AddNode("3")
+	dag.AddEdge("1", "2")
+	dag.AddEdge("1", "3")
+
+	var mu sync.Mutex
+	events := make(map[interface{}][]string)
+	record := func(key interface{}, event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events[key] = append(events[key], event)
+	}
+	dp := NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		record(node.key, "cb")
+		return nil
+	})
+	dp.SetLifecycleHooks(func(node *Node) {
+		record(node.key, "start")
+	}, func(node *Node, err error) {
+		assert.Nil(t, err)
+		record(node.key, "finish")
+	})
+	assert.Nil(t, dp.Run())
+	for _, key := range []string{"1", "2", "3"} {
+		assert.Equal(t, []string{"start", "cb", "finish"}, events[key])
+	}
+
+	// hooks are optional
+	dp = NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		return nil
+	})
+	dp.SetLifecycleHooks(nil, nil)
+	assert.Nil(t, dp.Run())
+}
+
+func TestDispatcher_Timings(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("fast")
+	dag.AddNode("slow")
+	dag.AddNode("failed")
+	dag.AddNode("skipped")
+	dag.AddEdge("fast", "slow")
+	dag.AddEdge("slow", "failed")
+	dag.AddEdge("failed", "skipped")
+
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		if node.key == "slow" {
+			time.Sleep(time.Millisecond * 20)
+		}
+		if node.key == "failed" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	assert.NotNil(t, dp.Run())
+
+	timings := dp.Timings()
+	assert.Equal(t, 3, len(timings))
+	assert.True(t, timings["slow"] >= time.Millisecond*20)
+	assert.True(t, timings["fast"] < timings["slow"])
+	_, ok := timings["skipped"]
+	assert.False(t, ok)
+}
+
+func TestDispatcher_EmptyDag(t *testing.T) {
+	dp := NewDispatcher(NewDag(), 4, 0, nil, func(node *Node, context interface{}) error {
+		return errors.New("should not be executed")
+	})
+	assert.Nil(t, dp.Run())
+
+	dp = NewDispatcher(NewDag(), 4, 1000, nil, func(node *Node, context interface{}) error {
+		return errors.New("should not be executed")
+	})
+	start := time.Now()
+	assert.Nil(t, dp.Run())
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestDispatcher_Abort(t *testing.T) {
+	dag := NewDag()
+	for i := 0; i < 10; i++ {
+		dag.AddNode(i)
+	}
+	for i := 1; i < 10; i++ {
+		dag.AddEdge(i-1, i)
+	}
+
+	var mu sync.Mutex
+	executed := 0
+	var dp *Dispatcher
+	dp = NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		mu.Lock()
+		executed++
+		mu.Unlock()
+		if node.key == 2 {
+			dp.AbortCh() <- struct{}{}
+			time.Sleep(time.Millisecond * 10)
+		}
+		return nil
+	})
+	assert.Equal(t, ErrAborted, dp.Run())
+	mu.Lock()
+	assert.True(t, executed < 10)
+	mu.Unlock()
+
+	dp = NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		return nil
+	})
+	close(dp.AbortCh())
+	assert.Equal(t, ErrAborted, dp.Run())
+}
+
+func TestDispatcher_OnComplete(t *testing.T) {
+	dag := NewDag()
+	for i := 1; i <= 10; i++ {
+		dag.AddNode(i)
+	}
+	for i := 2; i <= 10; i++ {
+		dag.AddEdge(1, i)
+	}
+
+	var dp *Dispatcher
+	dp = NewDispatcher(dag, 4, 0, nil, func(node *Node, context interface{}) error {
+		dp.SetResult(node, node.key.(int)*node.key.(int))
+		return nil
+	})
+	called := 0
+	sum := 0
+	dp.SetOnComplete(func(results map[interface{}]interface{}) error {
+		called++
+		for _, v := range results {
+			sum += v.(int)
+		}
+		return nil
+	})
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, 1, called)
+	assert.Equal(t, 385, sum)
+	assert.Equal(t, 10, len(dp.Results()))
+
+	// not called if the dispatch failed
+	dp = NewDispatcher(dag, 4, 0, nil, func(node *Node, context interface{}) error {
+		return errors.New("failed")
+	})
+	dp.SetOnComplete(func(results map[interface{}]interface{}) error {
+		t.Error("should not be called")
+		return nil
+	})
+	assert.NotNil(t, dp.Run())
+
+	// the error of the reduce step is returned
+	reduceErr := errors.New("reduce failed")
+	dp = NewDispatcher(dag, 4, 0, nil, func(node *Node, context interface{}) error {
+		return nil
+	})
+	dp.SetOnComplete(func(results map[interface{}]interface{}) error {
+		return reduceErr
+	})
+	assert.Equal(t, reduceErr, dp.Run())
+}
+
+func TestDispatcher_UnknownTask(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	dag.AddNode("c")
+	dag.AddEdge("a", "b")
+	dag.AddEdge("b", "c")
+
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		return nil
+	})
+
+	_, err := dp.onCompleteParentTask(dag.GetNode("a"))
+	assert.Equal(t, ErrUnknownTask, err)
+
+	dp.tasks["a"] = &Task{dependence: 0, node: dag.GetNode("a")}
+	_, err = dp.onCompleteParentTask(dag.GetNode("a"))
+	assert.Equal(t, ErrUnknownTask, err)
+
+	dp.tasks["b"] = &Task{dependence: 1, node: dag.GetNode("b")}
+	dp.queueCounter = 1
+	isFinish, err := dp.onCompleteParentTask(dag.GetNode("a"))
+	assert.Nil(t, err)
+	assert.False(t, isFinish)
+	assert.Equal(t, 1, dp.completedCounter)
+
+	_, err = dp.onCompleteParentTask(dag.GetNode("a"))
+	assert.Equal(t, ErrTaskCompleted, err)
+	assert.Equal(t, 1, dp.completedCounter)
+}
+
+func TestDispatcher_DryRun(t *testing.T) {
+	called := false
+	cb := func(node *Node, context interface{}) error {
+		called = true
+		return nil
+	}
+
+	dag := NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	dag.AddNode("c")
+	dag.AddNode("d")
+	dag.AddEdge("a", "b")
+	dag.AddEdge("b", "c")
+	assert.Nil(t, NewDispatcher(dag, 2, 0, nil, cb).DryRun())
+
+	dag.AddEdge("c", "b")
+	err := NewDispatcher(dag, 2, 0, nil, cb).DryRun()
+	unreachable, ok := err.(*UnreachableError)
+	assert.True(t, ok)
+	assert.Equal(t, ErrDagHasCirclular, unreachable.Err)
+	assert.Equal(t, []interface{}{"b", "c"}, unreachable.Keys)
+
+	dag = NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	dag.AddEdge("a", "b")
+	dp := NewDispatcher(dag, 2, 0, nil, cb)
+	dp.tasks["b"] = &Task{dependence: 2, node: dag.GetNode("b")}
+	err = dp.DryRun()
+	unreachable, ok = err.(*UnreachableError)
+	assert.True(t, ok)
+	assert.Equal(t, ErrInvalidCheckpoint, unreachable.Err)
+	assert.Equal(t, []interface{}{"b"}, unreachable.Keys)
+
+	assert.False(t, called)
+	assert.Nil(t, NewDispatcher(NewDag(), 2, 0, nil, cb).DryRun())
+}
+
+func TestDispatcher_RunSummary(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	dag.AddNode("c")
+	dag.AddEdge("a", "b")
+	dag.AddEdge("b", "c")
+
+	errFailed := errors.New("failed")
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		if node.key == "b" {
+			return errFailed
+		}
+		return nil
+	})
+	result := dp.RunSummary()
+	assert.Equal(t, errFailed, result.Err)
+	assert.Equal(t, 3, result.Total)
+	assert.Equal(t, 1, result.Completed)
+	assert.Equal(t, 0, result.Skipped)
+	assert.Equal(t, []interface{}{"b"}, result.FailedKeys)
+
+	data, err := dp.Checkpoint()
+	assert.Nil(t, err)
+	dp, err = RestoreDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		return nil
+	}, data)
+	assert.Nil(t, err)
+	result = dp.RunSummary()
+	assert.Nil(t, result.Err)
+	assert.Equal(t, 3, result.Total)
+	assert.Equal(t, 2, result.Completed)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, 0, len(result.FailedKeys))
+	assert.True(t, result.Elapsed >= 0)
+}
+
+func TestDispatcher_WorkerBalance(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("slow")
+	for i := 0; i < 60; i++ {
+		dag.AddNode(i)
+	}
+
+	dp := NewDispatcher(dag, 4, 0, nil, func(node *Node, context interface{}) error {
+		if node.key == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+		return nil
+	})
+	assert.Nil(t, dp.Run())
+
+	// the worker stuck on the slow node has the least load,
+	// the fast nodes are spread evenly over the other workers
+	load := dp.WorkerLoad()
+	assert.Equal(t, 4, len(load))
+	sort.Ints(load)
+	total := 0
+	for _, n := range load {
+		total += n
+	}
+	assert.Equal(t, 61, total)
+	assert.True(t, load[3]-load[1] <= 2, "unbalanced load %v", load)
+}
+
+func TestDispatcher_Cancel(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	dag.AddNode("c")
+	dag.AddNode("d")
+	dag.AddEdge("a", "b")
+	dag.AddEdge("a", "c")
+	dag.AddEdge("d", "c")
+
+	var mu sync.Mutex
+	executed := make(map[interface{}]bool)
+	dp := NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		mu.Lock()
+		executed[node.key] = true
+		mu.Unlock()
+		return nil
+	})
+	assert.Equal(t, ErrUnknownTask, dp.Cancel("e"))
+
+	// b only depends on a, c still runs after d
+	assert.Nil(t, dp.Cancel("a"))
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, map[interface{}]bool{"c": true, "d": true}, executed)
+}
+
+func TestDispatcher_CancelRunning(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("slow")
+	dag.AddNode("x")
+	dag.AddNode("y")
+	dag.AddNode("z")
+	dag.AddEdge("slow", "x")
+	dag.AddEdge("slow", "y")
+	dag.AddEdge("z", "y")
+
+	var mu sync.Mutex
+	executed := make(map[interface{}]bool)
+	startedCh := make(chan bool)
+	blockCh := make(chan bool)
+	dp := NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		if node.key == "slow" {
+			startedCh <- true
+			<-blockCh
+		}
+		mu.Lock()
+		executed[node.key] = true
+		mu.Unlock()
+		return nil
+	})
+
+	go func() {
+		<-startedCh
+		assert.Equal(t, ErrTaskStarted, dp.Cancel("slow"))
+		assert.Nil(t, dp.Cancel("x"))
+		close(blockCh)
+	}()
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, map[interface{}]bool{"slow": true, "y": true, "z": true}, executed)
+	assert.Equal(t, ErrTaskStarted, dp.Cancel("y"))
+}
+
+func TestDispatcher_StopReleasesWorkers(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	dag := NewDag()
+	for i := 0; i < 100; i++ {
+		dag.AddNode(i)
+	}
+	errFailed := errors.New("failed")
+	for i := 0; i < 20; i++ {
+		dp := NewDispatcher(dag, 8, 0, nil, func(node *Node, context interface{}) error {
+			if node.key == 50 {
+				return errFailed
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		})
+		assert.Equal(t, errFailed, dp.Run())
+	}
+
+	// workers busy in callbacks exit once the callbacks return
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, runtime.NumGoroutine() <= before, "leaked goroutines %d > %d", runtime.NumGoroutine(), before)
+}
+
+func TestDispatcher_Start(t *testing.T) {
+	dag := NewDag()
+	for i := 0; i < 5; i++ {
+		dag.AddNode(i)
+	}
+	for i := 1; i < 5; i++ {
+		dag.AddEdge(i-1, i)
+	}
+
+	release := make(chan struct{})
+	dp := NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		if node.key == 2 {
+			<-release
+		}
+		return nil
+	})
+	errCh := dp.Start()
+
+	// the dispatch runs in the background, waiting for node 2
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if completed, _ := dp.Progress(); completed == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	completed, total := dp.Progress()
+	assert.Equal(t, 2, completed)
+	assert.Equal(t, 5, total)
+
+	close(release)
+	select {
+	case err := <-errCh:
+		assert.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("dispatch not finished")
+	}
+	_, ok := <-errCh
+	assert.False(t, ok)
+	completed, _ = dp.Progress()
+	assert.Equal(t, 5, completed)
+
+	errFailed := errors.New("failed")
+	dp = NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		return errFailed
+	})
+	assert.Equal(t, errFailed, <-dp.Start())
+
+	block := make(chan struct{})
+	dp = NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		<-block
+		return nil
+	})
+	errCh = dp.Start()
+	dp.AbortCh() <- struct{}{}
+	assert.Equal(t, ErrAborted, <-errCh)
+	close(block)
+}
+
+func TestDispatcher_Stop(t *testing.T) {
+	dag := GenerateLayeredDag(3, 2)
+	started := make(chan bool, 1)
+	block := make(chan struct{})
+	completed := false
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		if node.key == "1-0" {
+			started <- true
+			<-block
+		}
+		return nil
+	})
+	dp.SetOnComplete(func(results map[interface{}]interface{}) error {
+		completed = true
+		return nil
+	})
+	errCh := dp.Start()
+	<-started
+	dp.Stop()
+	close(block)
+	// a stopped dispatch doesn't look like a successful one
+	assert.Equal(t, ErrStopped, <-errCh)
+	assert.False(t, completed)
+	done, total := dp.Progress()
+	assert.True(t, done < total)
+	dp.Stop()
+}
+
+func TestDispatcher_ExclusionGroup(t *testing.T) {
+	dag := NewDag()
+	for i := 0; i < 12; i++ {
+		dag.AddNode(i)
+		switch i % 3 {
+		case 0:
+			dag.GetNode(i).SetExclusionGroup("db")
+		case 1:
+			dag.GetNode(i).SetExclusionGroup("file")
+		}
+	}
+	assert.Equal(t, "db", dag.GetNode(3).ExclusionGroup())
+	assert.Equal(t, "", dag.GetNode(2).ExclusionGroup())
+
+	var mu sync.Mutex
+	running := make(map[string]int)
+	maxRunning := make(map[string]int)
+	dp := NewDispatcher(dag, 6, 0, nil, func(node *Node, context interface{}) error {
+		group := node.ExclusionGroup()
+		mu.Lock()
+		running[group]++
+		if running[group] > maxRunning[group] {
+			maxRunning[group] = running[group]
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running[group]--
+		mu.Unlock()
+		return nil
+	})
+	assert.Nil(t, dp.Run())
+
+	completed, _ := dp.Progress()
+	assert.Equal(t, 12, completed)
+	assert.Equal(t, 1, maxRunning["db"])
+	assert.Equal(t, 1, maxRunning["file"])
+	// nodes of different groups and without a group run together
+	assert.True(t, maxRunning[""] > 1)
+}
+
+func TestDispatcher_ExclusionGroupCancel(t *testing.T) {
+	dag := NewDag()
+	for _, key := range []string{"a", "b", "c"} {
+		dag.AddNode(key)
+		dag.GetNode(key).SetExclusionGroup("db")
+	}
+
+	var dp *Dispatcher
+	executed := make(map[interface{}]bool)
+	dp = NewDispatcher(dag, 3, 0, nil, func(node *Node, context interface{}) error {
+		executed[node.key] = true
+		// the other nodes of the group are still waiting
+		for _, key := range []string{"a", "b", "c"} {
+			if !executed[key] {
+				dp.Cancel(key)
+				break
+			}
+		}
+		return nil
+	})
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, 2, len(executed))
+}
+
+func TestDispatcher_NodeWorkers(t *testing.T) {
+	dag := GenerateLayeredDag(4, 6)
+	dp := NewDispatcher(dag, 3, 0, nil, func(node *Node, context interface{}) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	dp.EnableTrace()
+	assert.Nil(t, dp.Run())
+
+	workers := dp.NodeWorkers()
+	assert.Equal(t, dag.Len(), len(workers))
+	load := make([]int, 3)
+	for _, worker := range workers {
+		assert.True(t, worker >= 0 && worker < 3)
+		load[worker]++
+	}
+	assert.Equal(t, dp.WorkerLoad(), load)
+	for _, e := range dp.Trace() {
+		assert.Equal(t, e.Worker, workers[e.Key])
+	}
+}
+
+// goroutineID parse the id of the current goroutine from its stack
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	return strings.Fields(string(buf))[1]
+}
+
+func TestDispatcher_Inline(t *testing.T) {
+	dag := GenerateLayeredDag(4, 5)
+	caller := goroutineID()
+	order := make([]interface{}, 0)
+	dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		assert.Equal(t, caller, goroutineID())
+		order = append(order, node.key)
+		return nil
+	})
+	dp.SetInline(true)
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, dag.Len(), len(order))
+	assert.Equal(t, []int{dag.Len()}, dp.WorkerLoad())
+
+	// the children run after their parents
+	pos := make(map[interface{}]int)
+	for i, key := range order {
+		pos[key] = i
+	}
+	for _, node := range dag.GetNodes() {
+		for _, child := range node.Children() {
+			assert.True(t, pos[node.key] < pos[child.key])
+		}
+	}
+
+	// a failing node stops the dispatch before the next one
+	dag = GenerateLayeredDag(3, 4)
+	count := 0
+	dp = NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		count++
+		return errors.New("failed")
+	})
+	dp.SetInline(true)
+	assert.NotNil(t, dp.Run())
+	assert.Equal(t, 1, count)
+
+	// more workers ignore the option
+	dag = GenerateLayeredDag(3, 4)
+	var mu sync.Mutex
+	inline := 0
+	dp = NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if goroutineID() == caller {
+			inline++
+		}
+		return nil
+	})
+	dp.SetInline(true)
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, 0, inline)
+}
+
+func TestDispatcher_InlineAbort(t *testing.T) {
+	dag := GenerateLayeredDag(3, 4)
+	count := 0
+	var dp *Dispatcher
+	dp = NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		count++
+		if count == 2 {
+			close(dp.AbortCh())
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	})
+	dp.SetInline(true)
+	assert.Equal(t, ErrAborted, dp.Run())
+	assert.Equal(t, 2, count)
+}
+
+func TestDispatcher_Undo(t *testing.T) {
+	dag := GenerateLayeredDag(4, 3)
+	var mu sync.Mutex
+	applied := make(map[interface{}]bool)
+	dp := NewDispatcher(dag, 3, 0, nil, func(node *Node, context interface{}) error {
+		if node.key == "2-1" {
+			return errors.New("failed")
+		}
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		applied[node.key] = true
+		mu.Unlock()
+		return nil
+	})
+	undone := make([]interface{}, 0)
+	dp.SetUndo(func(node *Node) {
+		// every child is undone before the node
+		for _, child := range node.children {
+			assert.False(t, applied[child.key])
+		}
+		delete(applied, node.key)
+		undone = append(undone, node.key)
+	})
+	assert.NotNil(t, dp.Run())
+	assert.Empty(t, applied)
+
+	order := dp.CompletedOrder()
+	assert.True(t, len(order) >= 3)
+	assert.Equal(t, len(order), len(undone))
+	for i, key := range undone {
+		assert.Equal(t, order[len(order)-1-i], key)
+	}
+
+	// a successful dispatch isn't undone
+	dp = NewDispatcher(dag, 3, 0, nil, func(node *Node, context interface{}) error {
+		return nil
+	})
+	dp.SetUndo(func(node *Node) {
+		t.Error("unexpected undo")
+	})
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, dag.Len(), len(dp.CompletedOrder()))
+
+	// a failed reduce step undoes every node
+	count := 0
+	dp = NewDispatcher(dag, 3, 0, nil, func(node *Node, context interface{}) error {
+		return nil
+	})
+	dp.SetOnComplete(func(results map[interface{}]interface{}) error {
+		return errors.New("failed")
+	})
+	dp.SetUndo(func(node *Node) {
+		count++
+	})
+	assert.NotNil(t, dp.Run())
+	assert.Equal(t, dag.Len(), count)
+}
+
+func TestDispatcher_EvictResults(t *testing.T) {
+	dag := GenerateLayeredDag(10, 3)
+	var dp *Dispatcher
+	var mu sync.Mutex
+	held := 0
+	cb := func(node *Node, context interface{}) error {
+		sum := 1
+		parents := dp.ParentResults(node)
+		if len(parents) != len(node.parents) {
+			return errors.New("missing parent result")
+		}
+		for _, result := range parents {
+			sum += result.(int)
+		}
+		dp.SetResult(node, sum)
+		mu.Lock()
+		if n := len(dp.Results()); n > held {
+			held = n
+		}
+		mu.Unlock()
+		return nil
+	}
+
+	dp = NewDispatcher(dag, 3, 0, nil, cb)
+	dp.SetEvictResults(true)
+	var final map[interface{}]interface{}
+	dp.SetOnComplete(func(results map[interface{}]interface{}) error {
+		final = results
+		return nil
+	})
+	assert.Nil(t, dp.Run())
+	// only the last layer is left, at most two layers were held at once
+	assert.Equal(t, 3, len(final))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 29524, final["9-"+strconv.Itoa(i)])
+	}
+	assert.True(t, held <= 6)
+
+	// all results are kept by default
+	held = 0
+	dp = NewDispatcher(dag, 3, 0, nil, cb)
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, dag.Len(), len(dp.Results()))
+
+	// a result whose only child is cancelled is evicted as well
+	dag = NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	dag.AddNode("c")
+	dag.AddEdge("a", "b")
+	dp = NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+		dp.SetResult(node, node.key)
+		return nil
+	})
+	dp.SetEvictResults(true)
+	assert.Nil(t, dp.Cancel("b"))
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, map[interface{}]interface{}{"c": "c"}, dp.Results())
+}
+
+func TestDispatcher_DeterministicOrder(t *testing.T) {
+	dag := NewDag()
+	for _, key := range []string{"k", "c", "x", "a", "m", "b", "z", "e"} {
+		dag.AddNode(key)
+	}
+	dag.AddEdge("k", "x")
+	dag.AddEdge("a", "z")
+	dag.AddEdge("c", "z")
+	dag.AddEdge("b", "e")
+
+	var expected []interface{}
+	for i := 0; i < 20; i++ {
+		order := make([]interface{}, 0)
+		dp := NewDispatcher(dag, 1, 0, nil, func(node *Node, context interface{}) error {
+			order = append(order, node.key)
+			return nil
+		})
+		assert.Nil(t, dp.Run())
+		if expected == nil {
+			expected = order
+		}
+		assert.Equal(t, expected, order)
+		assert.Equal(t, order, dp.CompletedOrder())
+	}
+	// the roots run in key order, children as they become ready
+	assert.Equal(t, []interface{}{"a", "b", "c", "k", "m", "e", "z", "x"}, expected)
+}
+
+func TestDispatcher_WaitOnFailure(t *testing.T) {
+	dag := GenerateLayeredDag(3, 4)
+	var dp *Dispatcher
+	started := make(chan bool, dag.Len())
+	var roots sync.WaitGroup
+	roots.Add(4)
+	dp = NewDispatcher(dag, 4, 0, nil, func(node *Node, context interface{}) error {
+		started <- true
+		roots.Done()
+		if node.key == "0-0" {
+			// fail while the other roots are running
+			roots.Wait()
+			return errors.New("failed")
+		}
+		time.Sleep(20 * time.Millisecond)
+		dp.SetResult(node, node.key)
+		return nil
+	})
+	dp.SetWaitOnFailure(true)
+	assert.NotNil(t, dp.Run())
+
+	results := dp.Results()
+	order := dp.CompletedOrder()
+	timings := dp.Timings()
+	workers := dp.NodeWorkers()
+
+	// the other roots were running and finished before Run returned
+	assert.Equal(t, 3, len(order))
+	assert.Equal(t, len(order), len(results))
+	for _, key := range order {
+		assert.Equal(t, key, results[key])
+		assert.NotNil(t, workers[key])
+	}
+	assert.Equal(t, 4, len(timings))
+	assert.Equal(t, 4, len(started))
+
+	// nothing changes afterwards
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, results, dp.Results())
+	assert.Equal(t, order, dp.CompletedOrder())
+	assert.Equal(t, timings, dp.Timings())
+	assert.Equal(t, 4, len(started))
+}
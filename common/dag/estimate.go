@@ -0,0 +1,91 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"time"
+)
+
+// EstimateDispatchTime simulate dispatching the dag with concurrency workers, where the
+// callback of each node takes cost(node), and return the estimated wall time. Like the
+// dispatcher, a free worker takes the node ready the longest, roots in key order, and
+// nodes of a busy exclusion group wait. No callback is run. The estimate is 0 if the dag
+// has cycles, concurrency <= 0 means 1.
+func (dag *Dag) EstimateDispatchTime(cost func(*Node) time.Duration, concurrency int) time.Duration {
+	if dag.IsCirclular() {
+		return 0
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	dependence := make(map[*Node]int, len(dag.nodes))
+	ready := make([]*Node, 0)
+	for _, node := range dag.nodes {
+		dependence[node] = node.parentCounter
+		if node.parentCounter == 0 {
+			ready = append(ready, node)
+		}
+	}
+	sortNodes(ready)
+
+	type run struct {
+		node *Node
+		end  time.Duration
+	}
+	running := make([]run, 0, concurrency)
+	groups := make(map[string]bool)
+	now := time.Duration(0)
+	for len(ready) > 0 || len(running) > 0 {
+		// hand the ready nodes to the free workers
+		for i := 0; i < len(ready) && len(running) < concurrency; {
+			node := ready[i]
+			if node.group != "" && groups[node.group] {
+				i++
+				continue
+			}
+			if node.group != "" {
+				groups[node.group] = true
+			}
+			running = append(running, run{node: node, end: now + cost(node)})
+			ready = append(ready[:i], ready[i+1:]...)
+		}
+
+		// finish the earliest node, ties go to the one started first
+		next := 0
+		for i, r := range running {
+			if r.end < running[next].end {
+				next = i
+			}
+		}
+		done := running[next]
+		running = append(running[:next], running[next+1:]...)
+		now = done.end
+		if done.node.group != "" {
+			delete(groups, done.node.group)
+		}
+		for _, child := range sortedChildren(done.node) {
+			dependence[child]--
+			if dependence[child] == 0 {
+				ready = append(ready, child)
+			}
+		}
+	}
+	return now
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDag_EstimateDispatchTime(t *testing.T) {
+	unit := func(node *Node) time.Duration { return time.Millisecond }
+
+	dag := GenerateLayeredDag(2, 4)
+	assert.Equal(t, 8*time.Millisecond, dag.EstimateDispatchTime(unit, 1))
+	assert.Equal(t, 4*time.Millisecond, dag.EstimateDispatchTime(unit, 2))
+	assert.Equal(t, 2*time.Millisecond, dag.EstimateDispatchTime(unit, 4))
+	assert.Equal(t, 2*time.Millisecond, dag.EstimateDispatchTime(unit, 16))
+	assert.Equal(t, 8*time.Millisecond, dag.EstimateDispatchTime(unit, 0))
+
+	// the critical path a -> c -> d bounds the time
+	dag = NewDag()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		dag.AddNode(key)
+	}
+	dag.AddEdge("a", "c")
+	dag.AddEdge("c", "d")
+	dag.AddEdge("b", "d")
+	cost := func(node *Node) time.Duration {
+		return map[interface{}]time.Duration{"a": 5, "b": 1, "c": 5, "d": 1}[node.key]
+	}
+	assert.Equal(t, time.Duration(11), dag.EstimateDispatchTime(cost, 2))
+	assert.Equal(t, time.Duration(12), dag.EstimateDispatchTime(cost, 1))
+
+	// nodes of an exclusion group never overlap
+	dag = NewDag()
+	for i := 0; i < 4; i++ {
+		dag.AddNode(i)
+		dag.GetNode(i).SetExclusionGroup("account")
+	}
+	assert.Equal(t, 4*time.Millisecond, dag.EstimateDispatchTime(unit, 4))
+	dag.GetNode(0).SetExclusionGroup("")
+	assert.Equal(t, 3*time.Millisecond, dag.EstimateDispatchTime(unit, 4))
+
+	assert.Equal(t, time.Duration(0), NewDag().EstimateDispatchTime(unit, 4))
+	dag.AddEdge(0, 1)
+	dag.AddEdge(1, 0)
+	assert.Equal(t, time.Duration(0), dag.EstimateDispatchTime(unit, 4))
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"math/rand"
+	"strconv"
+)
+
+// GenerateRandomDag generate a random dag with n nodes, each node has avgDegree out edges on average,
+// the same seed always generates the same dag
+func GenerateRandomDag(n int, avgDegree float64, seed int64) *Dag {
+	dag := NewDag()
+	for i := 0; i < n; i++ {
+		dag.AddNode(strconv.Itoa(i))
+	}
+	if n < 2 {
+		return dag
+	}
+
+	// edges only point from lower to higher index, so the dag never has a circle
+	p := 2 * avgDegree / float64(n-1)
+	r := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if r.Float64() < p {
+				dag.AddEdge(strconv.Itoa(i), strconv.Itoa(j))
+			}
+		}
+	}
+	return dag
+}
+
+// GenerateLayeredDag generate a dag with layers * widthPerLayer nodes,
+// each node depends on all the nodes of the previous layer
+func GenerateLayeredDag(layers, widthPerLayer int) *Dag {
+	dag := NewDag()
+	key := func(layer, i int) string {
+		return strconv.Itoa(layer) + "-" + strconv.Itoa(i)
+	}
+	for l := 0; l < layers; l++ {
+		for i := 0; i < widthPerLayer; i++ {
+			dag.AddNode(key(l, i))
+			if l == 0 {
+				continue
+			}
+			for j := 0; j < widthPerLayer; j++ {
+				dag.AddEdge(key(l-1, j), key(l, i))
+			}
+		}
+	}
+	return dag
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateRandomDag(t *testing.T) {
+	dag := GenerateRandomDag(100, 3, 1)
+	assert.Equal(t, 100, dag.Len())
+	assert.False(t, dag.IsCirclular())
+	assert.True(t, dag.Equal(GenerateRandomDag(100, 3, 1)))
+	assert.False(t, dag.Equal(GenerateRandomDag(100, 3, 2)))
+
+	edges := 0
+	for _, node := range dag.GetNodes() {
+		edges += len(node.children)
+	}
+	assert.True(t, edges > 150 && edges < 450)
+
+	assert.Equal(t, 0, GenerateRandomDag(0, 3, 1).Len())
+	assert.Equal(t, 1, GenerateRandomDag(1, 3, 1).Len())
+}
+
+func TestGenerateLayeredDag(t *testing.T) {
+	dag := GenerateLayeredDag(4, 3)
+	assert.Equal(t, 12, dag.Len())
+	assert.Equal(t, 4, dag.Depth())
+	assert.Equal(t, 3, len(dag.GetRootNodes()))
+	assert.Equal(t, 3, len(dag.GetChildrenNodes("1-0")))
+	assert.Equal(t, 0, len(dag.GetChildrenNodes("3-0")))
+}
+
+func BenchmarkDag_Levels(b *testing.B) {
+	dag := GenerateRandomDag(1000, 4, 1)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dag.Levels()
+	}
+}
+
+func BenchmarkDispatcher_Run(b *testing.B) {
+	dag := GenerateLayeredDag(10, 20)
+	for i := 0; i < b.N; i++ {
+		dp := NewDispatcher(dag, 8, 0, nil, func(node *Node, context interface{}) error {
+			return nil
+		})
+		dp.Run()
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// KeyMarshaler encode a node key into JSON
+type KeyMarshaler func(key interface{}) ([]byte, error)
+
+// KeyUnmarshaler decode a node key from JSON
+type KeyUnmarshaler func(data []byte) (interface{}, error)
+
+// jsonDag is the JSON adjacency list of a dag, nodes are in index order
+// and edges are pairs of positions in nodes
+type jsonDag struct {
+	Nodes []json.RawMessage `json:"nodes"`
+	Edges [][2]int          `json:"edges"`
+}
+
+// SetKeyMarshaler replace the JSON encoding of the node keys, nil restores the default
+func (dag *Dag) SetKeyMarshaler(marshal KeyMarshaler, unmarshal KeyUnmarshaler) {
+	dag.keyMarshaler = marshal
+	dag.keyUnmarshaler = unmarshal
+}
+
+// defaultKeyUnmarshaler decode integers as int, other numbers as float64, strings and bools
+// as encoding/json does, ErrInvalidJSONKey is returned for null, objects and arrays
+func defaultKeyUnmarshaler(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var key interface{}
+	if err := decoder.Decode(&key); err != nil {
+		return nil, err
+	}
+	if n, ok := key.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			return int(i), nil
+		}
+		return n.Float64()
+	}
+	switch key.(type) {
+	case string, bool:
+		return key, nil
+	}
+	return nil, ErrInvalidJSONKey
+}
+
+// MarshalJSON encode the dag as {"nodes":[key,...],"edges":[[from,to],...]},
+// keys are in index order and edges refer to the positions of the keys
+func (dag *Dag) MarshalJSON() ([]byte, error) {
+	marshal := dag.keyMarshaler
+	if marshal == nil {
+		marshal = json.Marshal
+	}
+
+	msg := &jsonDag{
+		Nodes: make([]json.RawMessage, 0, dag.Len()),
+		Edges: make([][2]int, 0),
+	}
+	nodes := make([]*Node, 0, dag.Len())
+	positions := make(map[*Node]int, dag.Len())
+	for i := 0; i <= dag.index; i++ {
+		key, ok := dag.indexs[i]
+		if !ok {
+			continue
+		}
+		data, err := marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		positions[dag.nodes[key]] = len(nodes)
+		nodes = append(nodes, dag.nodes[key])
+		msg.Nodes = append(msg.Nodes, data)
+	}
+	for _, node := range nodes {
+		for _, child := range node.children {
+			msg.Edges = append(msg.Edges, [2]int{positions[node], positions[child]})
+		}
+	}
+	return json.Marshal(msg)
+}
+
+// UnmarshalJSON add the nodes and edges of the JSON adjacency list to the dag,
+// nodes are indexed by their position. Call it on an empty dag, e.g. from NewDag.
+// ErrInvalidJSONKey is returned if a key can't be a map key, see defaultKeyUnmarshaler.
+func (dag *Dag) UnmarshalJSON(data []byte) error {
+	msg := new(jsonDag)
+	if err := json.Unmarshal(data, msg); err != nil {
+		return err
+	}
+	if dag.nodes == nil {
+		*dag = *NewDag()
+	}
+	unmarshal := dag.keyUnmarshaler
+	if unmarshal == nil {
+		unmarshal = defaultKeyUnmarshaler
+	}
+
+	keys := make([]interface{}, len(msg.Nodes))
+	for i, raw := range msg.Nodes {
+		key, err := unmarshal(raw)
+		if err != nil {
+			return err
+		}
+		// a custom unmarshaler may return a map or slice, which would panic as a map key
+		if k := dag.keyOf(key); k == nil || !reflect.TypeOf(k).Comparable() {
+			return ErrInvalidJSONKey
+		}
+		if err := dag.AddNode(key); err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+	for _, edge := range msg.Edges {
+		if edge[0] < 0 || edge[0] >= len(keys) || edge[1] < 0 || edge[1] >= len(keys) {
+			return ErrKeyNotFound
+		}
+		if err := dag.AddEdge(keys[edge[0]], keys[edge[1]]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
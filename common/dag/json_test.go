@@ -0,0 +1,145 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDag_MarshalJSON(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("a")
+	dag.AddNode(2)
+	dag.AddNode("c")
+	dag.AddEdge("a", 2)
+	dag.AddEdge("a", "c")
+	dag.AddEdge(2, "c")
+
+	data, err := json.Marshal(dag)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"nodes":["a",2,"c"],"edges":[[0,1],[0,2],[1,2]]}`, string(data))
+
+	restored := NewDag()
+	assert.Nil(t, json.Unmarshal(data, restored))
+	assert.True(t, dag.Equal(restored))
+
+	// a zero dag is usable too
+	var zero Dag
+	assert.Nil(t, json.Unmarshal(data, &zero))
+	assert.True(t, dag.Equal(&zero))
+
+	empty, err := json.Marshal(NewDag())
+	assert.Nil(t, err)
+	assert.Equal(t, `{"nodes":[],"edges":[]}`, string(empty))
+}
+
+func TestDag_MarshalJSONGenerated(t *testing.T) {
+	dag := GenerateRandomDag(100, 2, 3)
+	data, err := json.Marshal(dag)
+	assert.Nil(t, err)
+	restored := NewDag()
+	assert.Nil(t, json.Unmarshal(data, restored))
+	assert.True(t, dag.Equal(restored))
+}
+
+func TestDag_UnmarshalJSONExternal(t *testing.T) {
+	// written by hand or by a tool outside go
+	data := `{"nodes": ["fetch", "parse", "store"], "edges": [[0, 1], [1, 2]]}`
+	dag := NewDag()
+	assert.Nil(t, json.Unmarshal([]byte(data), dag))
+	assert.Equal(t, 3, dag.Len())
+	assert.Equal(t, "parse", dag.GetNode("fetch").Children()[0].key)
+	assert.Nil(t, dag.Validate())
+
+	assert.Equal(t, ErrKeyNotFound, json.Unmarshal([]byte(`{"nodes":["a"],"edges":[[0,1]]}`), NewDag()))
+	assert.Equal(t, ErrKeyIsExisted, json.Unmarshal([]byte(`{"nodes":["a","a"]}`), NewDag()))
+	assert.Equal(t, ErrSelfLoop, json.Unmarshal([]byte(`{"nodes":["a"],"edges":[[0,0]]}`), NewDag()))
+	assert.NotNil(t, json.Unmarshal([]byte(`{"nodes":`), NewDag()))
+
+	// keys must be scalars
+	for _, key := range []string{`{"a":1}`, `["a"]`, `null`} {
+		data := `{"nodes":[` + key + `],"edges":[]}`
+		assert.Equal(t, ErrInvalidJSONKey, json.Unmarshal([]byte(data), NewDag()))
+	}
+	custom := NewDag()
+	custom.SetKeyMarshaler(nil, func(data []byte) (interface{}, error) {
+		var key interface{}
+		err := json.Unmarshal(data, &key)
+		return key, err
+	})
+	assert.Equal(t, ErrInvalidJSONKey, json.Unmarshal([]byte(`{"nodes":[[1,2]]}`), custom))
+	dag = NewDag()
+	assert.Nil(t, json.Unmarshal([]byte(`{"nodes":[true, 1.5, 2]}`), dag))
+	assert.Equal(t, 3, dag.Len())
+}
+
+func TestDag_MarshalJSONKeyMarshaler(t *testing.T) {
+	type txKey struct {
+		Block int
+		Tx    string
+	}
+	errBadKey := errors.New("bad key")
+	marshal := func(key interface{}) ([]byte, error) {
+		k, ok := key.(txKey)
+		if !ok {
+			return nil, errBadKey
+		}
+		return json.Marshal(k)
+	}
+	unmarshal := func(data []byte) (interface{}, error) {
+		var k txKey
+		err := json.Unmarshal(data, &k)
+		return k, err
+	}
+
+	dag := NewDag()
+	dag.SetKeyMarshaler(marshal, unmarshal)
+	dag.AddNode(txKey{1, "tx1"})
+	dag.AddNode(txKey{1, "tx2"})
+	dag.AddEdge(txKey{1, "tx1"}, txKey{1, "tx2"})
+	data, err := json.Marshal(dag)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(data), `{"Block":1,"Tx":"tx2"}`))
+
+	restored := NewDag()
+	restored.SetKeyMarshaler(marshal, unmarshal)
+	assert.Nil(t, json.Unmarshal(data, restored))
+	assert.True(t, dag.Equal(restored))
+
+	dag.AddNode("plain")
+	_, err = json.Marshal(dag)
+	assert.NotNil(t, err)
+
+	// interned keys are written in hex and read back by a dag interning them
+	interned := NewDagWithKeyFunc(InternHexKey)
+	interned.AddNode("0a0b")
+	interned.AddNode([]byte{0x0c, 0x0d})
+	interned.AddEdge("0a0b", "0c0d")
+	data, err = json.Marshal(interned)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"nodes":["0a0b","0c0d"],"edges":[[0,1]]}`, string(data))
+	restored = NewDagWithKeyFunc(InternHexKey)
+	assert.Nil(t, json.Unmarshal(data, restored))
+	assert.True(t, interned.Equal(restored))
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"encoding/hex"
+)
+
+// KeyFunc convert the key of a node into the key indexing the dag,
+// it must return the same key when applied to its own result
+type KeyFunc func(key interface{}) interface{}
+
+// internedKey is a binary key produced by the intern key funcs
+type internedKey string
+
+// String return the hex form of the key
+func (k internedKey) String() string {
+	return hex.EncodeToString([]byte(k))
+}
+
+// MarshalText encode the key in hex, a dag using InternHexKey reads it back as the same key
+func (k internedKey) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// InternBytesKey index []byte keys by their content, other keys are kept as is
+func InternBytesKey(key interface{}) interface{} {
+	if b, ok := key.([]byte); ok {
+		return internedKey(b)
+	}
+	return key
+}
+
+// InternHexKey index hex string keys, such as transaction hashes, by their decoded bytes,
+// which halves the length of the indexed keys. A hex string and the []byte it
+// decodes to are the same key, strings that aren't hex are kept as is.
+func InternHexKey(key interface{}) interface{} {
+	if s, ok := key.(string); ok {
+		if b, err := hex.DecodeString(s); err == nil {
+			return internedKey(b)
+		}
+		return key
+	}
+	return InternBytesKey(key)
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDag_InternBytesKey(t *testing.T) {
+	dag := NewDagWithKeyFunc(InternBytesKey)
+	assert.Nil(t, dag.AddNode([]byte{1, 2}))
+	assert.Nil(t, dag.AddNode([]byte{3, 4}))
+	assert.Nil(t, dag.AddNode("plain"))
+	assert.Equal(t, ErrKeyIsExisted, dag.AddNode([]byte{1, 2}))
+	assert.Nil(t, dag.AddEdge([]byte{1, 2}, []byte{3, 4}))
+	assert.Nil(t, dag.AddEdge([]byte{1, 2}, "plain"))
+
+	assert.Equal(t, 2, len(dag.GetChildrenNodes([]byte{1, 2})))
+	assert.Equal(t, "0102", dag.GetNode([]byte{1, 2}).String())
+
+	count := 0
+	dp := NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		count++
+		return nil
+	})
+	assert.Nil(t, dp.Cancel("plain"))
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, 2, count)
+	assert.True(t, dag.Transpose().Equal(dag.Transpose()))
+	assert.Equal(t, 1, len(dag.Transpose().GetChildrenNodes([]byte{3, 4})))
+}
+
+func TestDag_InternHexKey(t *testing.T) {
+	dag := NewDagWithKeyFunc(InternHexKey)
+	assert.Nil(t, dag.AddNode("0a0b"))
+	assert.Equal(t, ErrKeyIsExisted, dag.AddNode([]byte{0x0a, 0x0b}))
+	assert.Nil(t, dag.AddNode("not hex"))
+	assert.Nil(t, dag.AddEdge([]byte{0x0a, 0x0b}, "not hex"))
+	assert.Equal(t, 1, len(dag.GetChildrenNodes("0a0b")))
+	assert.Equal(t, "0a0b", dag.GetNode("0a0b").String())
+	assert.Equal(t, "not hex", dag.GetNode("not hex").String())
+	assert.Equal(t, 1, len(dag.clone().GetChildrenNodes("0a0b")))
+}
+
+func benchmarkDagLookup(b *testing.B, dag *Dag) {
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = byteutils.Hex(hash.Sha3256([]byte(strconv.Itoa(i))))
+		dag.AddNode(keys[i])
+	}
+	for i := 1; i < len(keys); i++ {
+		dag.AddEdge(keys[i/2], keys[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dag.GetChildrenNodes(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkDag_GetChildrenNodes(b *testing.B) {
+	benchmarkDagLookup(b, NewDag())
+}
+
+func BenchmarkDag_GetChildrenNodesInternHexKey(b *testing.B) {
+	benchmarkDagLookup(b, NewDagWithKeyFunc(InternHexKey))
+}
+
+func BenchmarkDag_GetChildrenNodesInternBytesKey(b *testing.B) {
+	dag := NewDagWithKeyFunc(InternBytesKey)
+	keys := make([][]byte, 100000)
+	for i := range keys {
+		keys[i] = hash.Sha3256([]byte(strconv.Itoa(i)))
+		dag.AddNode(keys[i])
+	}
+	for i := 1; i < len(keys); i++ {
+		dag.AddEdge(keys[i/2], keys[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dag.GetChildrenNodes(keys[i%len(keys)])
+	}
+}
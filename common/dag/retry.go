@@ -0,0 +1,81 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"time"
+)
+
+// Retryable is implemented by callback errors that know whether they are transient.
+// A callback marks its error retryable by returning an error whose Retryable() is true,
+// e.g. RetryableError(err), any other error is fatal.
+type Retryable interface {
+	Retryable() bool
+}
+
+// retryableError mark the wrapped error as transient
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Retryable() bool {
+	return true
+}
+
+// RetryableError wrap err so that the dispatcher retries the callback in retry mode
+func RetryableError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// IsRetryable return whether err is a transient callback error
+func IsRetryable(err error) bool {
+	r, ok := err.(Retryable)
+	return ok && r.Retryable()
+}
+
+// SetRetry enable retry mode, a callback returning a retryable error is called again
+// up to maxRetries times, waiting backoff between attempts. Fatal errors fail the
+// dispatch at once. Should be called before Run.
+func (dp *Dispatcher) SetRetry(maxRetries int, backoff time.Duration) {
+	dp.maxRetries = maxRetries
+	dp.retryBackoff = backoff
+}
+
+// callWithRetry call the callback of the node, retrying transient errors in retry mode
+func (dp *Dispatcher) callWithRetry(node *Node) error {
+	err := dp.call(node)
+	for attempt := 0; attempt < dp.maxRetries && IsRetryable(err); attempt++ {
+		if dp.retryBackoff > 0 {
+			select {
+			case <-dp.clock.After(dp.retryBackoff):
+			case <-dp.doneCh:
+				return err
+			}
+		}
+		err = dp.call(node)
+	}
+	return err
+}
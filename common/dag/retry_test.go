@@ -0,0 +1,105 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	errTransient := errors.New("transient")
+	assert.True(t, IsRetryable(RetryableError(errTransient)))
+	assert.Equal(t, "transient", RetryableError(errTransient).Error())
+	assert.False(t, IsRetryable(errTransient))
+	assert.False(t, IsRetryable(nil))
+	assert.Nil(t, RetryableError(nil))
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("flaky")
+	dag.AddNode("fatal")
+	dag.AddNode("child")
+	dag.AddEdge("flaky", "child")
+
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+
+	var mu sync.Mutex
+	calls := make(map[interface{}]int)
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = make(map[interface{}]int)
+	}
+	count := func(key interface{}) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[key]
+	}
+	cb := func(node *Node, context interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[node.key]++
+		if node.key == "flaky" && calls[node.key] < 3 {
+			return RetryableError(errTransient)
+		}
+		return nil
+	}
+
+	// transient errors are retried
+	dp := NewDispatcher(dag, 2, 0, nil, cb)
+	dp.SetRetry(3, time.Millisecond)
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, 3, count("flaky"))
+	assert.Equal(t, 1, count("child"))
+
+	// without retry mode the first error fails the dispatch
+	reset()
+	dp = NewDispatcher(dag, 2, 0, nil, cb)
+	assert.True(t, IsRetryable(dp.Run()))
+	assert.Equal(t, 1, count("flaky"))
+
+	// retries are bounded
+	reset()
+	dp = NewDispatcher(dag, 2, 0, nil, cb)
+	dp.SetRetry(1, 0)
+	assert.True(t, IsRetryable(dp.Run()))
+	assert.Equal(t, 2, count("flaky"))
+
+	// fatal errors are never retried, even in retry mode
+	reset()
+	dp = NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[node.key]++
+		if node.key == "fatal" {
+			return errFatal
+		}
+		return nil
+	})
+	dp.SetRetry(5, 0)
+	assert.Equal(t, errFatal, dp.Run())
+	assert.Equal(t, 1, count("fatal"))
+}
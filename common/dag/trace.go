@@ -0,0 +1,85 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TraceEvent is the execution of a node on a worker
+type TraceEvent struct {
+	Key    interface{}
+	Worker int
+	Start  time.Time
+	End    time.Time
+}
+
+// chromeTraceEvent is a complete event of the chrome trace event format
+type chromeTraceEvent struct {
+	Name      string `json:"name"`
+	Phase     string `json:"ph"`
+	Timestamp int64  `json:"ts"`
+	Duration  int64  `json:"dur"`
+	Pid       int    `json:"pid"`
+	Tid       int    `json:"tid"`
+}
+
+// EnableTrace record the start and end of every node on its worker, should be called before Run
+func (dp *Dispatcher) EnableTrace() {
+	dp.muTimings.Lock()
+	defer dp.muTimings.Unlock()
+	dp.tracing = true
+}
+
+// Trace return the recorded events ordered by completion
+func (dp *Dispatcher) Trace() []*TraceEvent {
+	dp.muTimings.Lock()
+	defer dp.muTimings.Unlock()
+	trace := make([]*TraceEvent, len(dp.trace))
+	copy(trace, dp.trace)
+	return trace
+}
+
+// TraceJSON return the recorded events in the chrome trace event format,
+// which can be loaded by chrome://tracing or speedscope as a timeline per worker.
+// Timestamps are microseconds since the first node started.
+func (dp *Dispatcher) TraceJSON() ([]byte, error) {
+	trace := dp.Trace()
+	var origin time.Time
+	for _, e := range trace {
+		if origin.IsZero() || e.Start.Before(origin) {
+			origin = e.Start
+		}
+	}
+
+	events := make([]*chromeTraceEvent, len(trace))
+	for i, e := range trace {
+		events[i] = &chromeTraceEvent{
+			Name:      fmt.Sprint(e.Key),
+			Phase:     "X",
+			Timestamp: int64(e.Start.Sub(origin) / time.Microsecond),
+			Duration:  int64(e.End.Sub(e.Start) / time.Microsecond),
+			Pid:       1,
+			Tid:       e.Worker,
+		}
+	}
+	return json.Marshal(map[string]interface{}{"traceEvents": events})
+}
@@ -0,0 +1,78 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package dag
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatcher_Trace(t *testing.T) {
+	dag := NewDag()
+	dag.AddNode("a")
+	dag.AddNode("b")
+	dag.AddNode("c")
+	dag.AddEdge("a", "b")
+	dag.AddEdge("a", "c")
+
+	dp := NewDispatcher(dag, 2, 0, nil, func(node *Node, context interface{}) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	dp.EnableTrace()
+	assert.Nil(t, dp.Run())
+
+	trace := dp.Trace()
+	assert.Equal(t, 3, len(trace))
+	assert.Equal(t, "a", trace[0].Key)
+	for _, e := range trace {
+		assert.True(t, e.Worker >= 0 && e.Worker < 2)
+		assert.False(t, e.End.Before(e.Start))
+		if e.Key != "a" {
+			assert.False(t, e.Start.Before(trace[0].End))
+		}
+	}
+
+	data, err := dp.TraceJSON()
+	assert.Nil(t, err)
+	var decoded struct {
+		TraceEvents []struct {
+			Name string `json:"name"`
+			Ph   string `json:"ph"`
+			Ts   int64  `json:"ts"`
+			Dur  int64  `json:"dur"`
+			Tid  int    `json:"tid"`
+		} `json:"traceEvents"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, 3, len(decoded.TraceEvents))
+	assert.Equal(t, "a", decoded.TraceEvents[0].Name)
+	assert.Equal(t, "X", decoded.TraceEvents[0].Ph)
+	assert.Equal(t, int64(0), decoded.TraceEvents[0].Ts)
+	assert.True(t, decoded.TraceEvents[0].Dur >= 5000)
+	assert.True(t, decoded.TraceEvents[1].Ts >= decoded.TraceEvents[0].Dur)
+
+	// tracing is off by default
+	dp = NewDispatcher(dag, 2, 0, nil, dp.cb)
+	assert.Nil(t, dp.Run())
+	assert.Equal(t, 0, len(dp.Trace()))
+}
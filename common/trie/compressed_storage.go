@@ -0,0 +1,96 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/nebulasio/go-nebulas/storage"
+)
+
+// compressedMarker starts the compressed values, a serialized node never starts with it
+const compressedMarker byte = 0x00
+
+// compressedStorage compress the values written to the wrapped storage
+type compressedStorage struct {
+	storage.Storage
+	writers sync.Pool
+	readers sync.Pool
+}
+
+// NewCompressedStorage wrap stor so that trie nodes are stored compressed and decompressed
+// when fetched. Nodes are hashed before they reach the storage, so root hashes and proofs are
+// the same as without compression. Uncompressed nodes already in stor are still readable,
+// and nodes that don't shrink are stored as is.
+func NewCompressedStorage(stor storage.Storage) storage.Storage {
+	return &compressedStorage{Storage: stor}
+}
+
+// Put compress the value and put it into the wrapped storage
+func (s *compressedStorage) Put(key []byte, value []byte) error {
+	var buf bytes.Buffer
+	buf.WriteByte(compressedMarker)
+	w, _ := s.writers.Get().(*flate.Writer)
+	if w == nil {
+		var err error
+		if w, err = flate.NewWriter(&buf, flate.BestSpeed); err != nil {
+			return err
+		}
+	} else {
+		w.Reset(&buf)
+	}
+	defer s.writers.Put(w)
+	if _, err := w.Write(value); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// a value starting with the marker must be compressed to be told apart
+	if buf.Len() >= len(value) && (len(value) == 0 || value[0] != compressedMarker) {
+		return s.Storage.Put(key, value)
+	}
+	return s.Storage.Put(key, buf.Bytes())
+}
+
+// Get the value from the wrapped storage and decompress it
+func (s *compressedStorage) Get(key []byte) ([]byte, error) {
+	value, err := s.Storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(value) == 0 || value[0] != compressedMarker {
+		return value, nil
+	}
+
+	src := bytes.NewReader(value[1:])
+	r, _ := s.readers.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReader(src)
+	} else if err := r.(flate.Resetter).Reset(src, nil); err != nil {
+		return nil, err
+	}
+	defer s.readers.Put(r)
+	return ioutil.ReadAll(r)
+}
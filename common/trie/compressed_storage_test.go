@@ -0,0 +1,155 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// sizeStorage sums up the bytes of the values put into the storage
+type sizeStorage struct {
+	storage.Storage
+	size int
+}
+
+func (s *sizeStorage) Put(key []byte, value []byte) error {
+	s.size += len(value)
+	return s.Storage.Put(key, value)
+}
+
+// accountValue mimics an account with a sparse balance and a random storage root
+func accountValue(i int) []byte {
+	value := make([]byte, 0, 96)
+	value = append(value, hash.Sha3256([]byte{byte(i >> 8), byte(i)})[:26]...)
+	value = append(value, make([]byte, 14)...)
+	value = append(value, byte(i>>8), byte(i))
+	value = append(value, make([]byte, 8)...)
+	value = append(value, hash.Sha3256([]byte{byte(i), byte(i >> 8)})...)
+	return value
+}
+
+func buildAccountTrie(stor storage.Storage, n int) (*Trie, [][]byte, error) {
+	tr, err := NewTrie(nil, stor, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		keys[i] = hash.Sha3256([]byte{0x01, byte(i >> 8), byte(i)})
+		if _, err := tr.Put(keys[i], accountValue(i)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tr, keys, nil
+}
+
+func TestCompressedStorage(t *testing.T) {
+	raw, _ := storage.NewMemoryStorage()
+	stor := NewCompressedStorage(raw)
+
+	for _, value := range [][]byte{
+		{},
+		[]byte("x"),
+		{compressedMarker},
+		append([]byte{compressedMarker}, bytes.Repeat([]byte{0x01}, 64)...),
+		bytes.Repeat([]byte("nebulas"), 32),
+	} {
+		assert.Nil(t, stor.Put([]byte("key"), value))
+		got, err := stor.Get([]byte("key"))
+		assert.Nil(t, err)
+		assert.Equal(t, value, got)
+	}
+
+	stored, _ := raw.Get([]byte("key"))
+	assert.Equal(t, compressedMarker, stored[0])
+	assert.True(t, len(stored) < 7*32)
+
+	// uncompressed values already in the storage are still readable
+	assert.Nil(t, raw.Put([]byte("old"), []byte("\x0a\x01plain")))
+	got, err := stor.Get([]byte("old"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("\x0a\x01plain"), got)
+
+	_, err = stor.Get([]byte("missing"))
+	assert.Equal(t, storage.ErrKeyNotFound, err)
+}
+
+func TestTrie_CompressedStorage(t *testing.T) {
+	plainStor, _ := storage.NewMemoryStorage()
+	plainSize := &sizeStorage{Storage: plainStor}
+	plain, keys, err := buildAccountTrie(plainSize, 500)
+	assert.Nil(t, err)
+
+	compStor, _ := storage.NewMemoryStorage()
+	compSize := &sizeStorage{Storage: compStor}
+	comp, _, err := buildAccountTrie(NewCompressedStorage(compSize), 500)
+	assert.Nil(t, err)
+
+	assert.Equal(t, plain.RootHash(), comp.RootHash())
+	assert.True(t, compSize.size < plainSize.size)
+
+	reopened, err := NewTrie(comp.RootHash(), NewCompressedStorage(compStor), false)
+	assert.Nil(t, err)
+	for i, key := range keys {
+		value, err := reopened.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, accountValue(i), value)
+	}
+
+	proof, err := comp.Prove(keys[7])
+	assert.Nil(t, err)
+	plainProof, err := plain.Prove(keys[7])
+	assert.Nil(t, err)
+	assert.Equal(t, plainProof, proof)
+	assert.Nil(t, plain.Verify(plain.RootHash(), keys[7], proof))
+}
+
+func benchmarkFetch(b *testing.B, compress bool) {
+	raw, _ := storage.NewMemoryStorage()
+	sized := &sizeStorage{Storage: raw}
+	var stor storage.Storage = sized
+	if compress {
+		stor = NewCompressedStorage(sized)
+	}
+	tr, keys, err := buildAccountTrie(stor, 5000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Logf("stored %d bytes", sized.size)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tr.Get(keys[i%len(keys)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTrie_Fetch(b *testing.B) {
+	benchmarkFetch(b, false)
+}
+
+func BenchmarkTrie_FetchCompressed(b *testing.B) {
+	benchmarkFetch(b, true)
+}
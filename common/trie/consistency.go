@@ -0,0 +1,118 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Errors
+var (
+	ErrNotAppendOnly = errors.New("new root modifies or removes keys of the old root")
+	ErrKeyNotAdded   = errors.New("consistency proof adds a key already in the old root")
+)
+
+// ConsistencyProof proves that newRoot holds every key of oldRoot with the same value,
+// the only changes between the roots are the Additions
+type ConsistencyProof struct {
+	// Additions are the keys of newRoot missing in oldRoot, in key order
+	Additions  []KV
+	Transition *TransitionProof
+}
+
+// ProveConsistency prove that the trie at newRoot is the trie at oldRoot plus some new keys,
+// ErrNotAppendOnly is returned if a key of oldRoot is removed or changed in newRoot.
+// The nodes of both roots must be in the storage of the trie.
+func (t *Trie) ProveConsistency(oldRoot, newRoot []byte) (*ConsistencyProof, error) {
+	old := make(map[string][]byte)
+	if !IsEmptyRoot(oldRoot) {
+		if err := t.walk(oldRoot, []byte{}, func(key, value []byte) error {
+			old[string(key)] = value
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	additions := make([]KV, 0)
+	kept := 0
+	if !IsEmptyRoot(newRoot) {
+		if err := t.walk(newRoot, []byte{}, func(key, value []byte) error {
+			oldValue, ok := old[string(key)]
+			if !ok {
+				additions = append(additions, KV{Key: key, Value: value})
+				return nil
+			}
+			if !bytes.Equal(oldValue, value) {
+				return ErrNotAppendOnly
+			}
+			kept++
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if kept != len(old) {
+		return nil, ErrNotAppendOnly
+	}
+
+	transition, err := t.ProveTransition(oldRoot, newRoot, additions)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsistencyProof{Additions: additions, Transition: transition}, nil
+}
+
+// VerifyConsistency verify that no key of oldRoot is removed or changed in newRoot.
+// The additions are replayed from oldRoot with the nodes of the proof, each must be missing
+// in the trie before it's put, so it can't be a key of oldRoot, and the result must be newRoot.
+func (t *Trie) VerifyConsistency(oldRoot, newRoot []byte, proof *ConsistencyProof) error {
+	if proof == nil || proof.Transition == nil {
+		return ErrMalformedProof
+	}
+
+	tr := &Trie{
+		rootHash:      oldRoot,
+		storage:       newWitnessStorage(proof.Transition.index()),
+		maxProofDepth: t.maxProofDepth,
+		serializer:    t.serializer,
+	}
+	for _, kv := range proof.Additions {
+		if kv.Value == nil {
+			return ErrNotAppendOnly
+		}
+		if !tr.Empty() {
+			_, err := tr.Get(kv.Key)
+			if err == nil {
+				return ErrKeyNotAdded
+			}
+			if err != ErrNotFound {
+				return err
+			}
+		}
+		if _, err := tr.Put(kv.Key, kv.Value); err != nil {
+			return err
+		}
+	}
+	if !sameRoot(tr.rootHash, newRoot) {
+		return ErrTransitionMismatch
+	}
+	return nil
+}
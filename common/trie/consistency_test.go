@@ -0,0 +1,87 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_ProveConsistency(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	key := func(i int) []byte { return hash.Sha3256([]byte{byte(i >> 8), byte(i)}) }
+	for i := 0; i < 200; i++ {
+		tr.Put(key(i), []byte{byte(i)})
+	}
+	oldRoot := tr.RootHash()
+	for i := 200; i < 300; i++ {
+		tr.Put(key(i), []byte{byte(i)})
+	}
+	newRoot := tr.RootHash()
+
+	proof, err := tr.ProveConsistency(oldRoot, newRoot)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(proof.Additions))
+
+	emptyStor, _ := storage.NewMemoryStorage()
+	verifier, _ := NewTrie(nil, emptyStor, false)
+	assert.Nil(t, verifier.VerifyConsistency(oldRoot, newRoot, proof))
+	assert.NotNil(t, verifier.VerifyConsistency(newRoot, oldRoot, proof))
+
+	// the same root and an empty old root are consistent
+	same, err := tr.ProveConsistency(oldRoot, oldRoot)
+	assert.Nil(t, err)
+	assert.Empty(t, same.Additions)
+	assert.Nil(t, verifier.VerifyConsistency(oldRoot, oldRoot, same))
+	all, err := tr.ProveConsistency(nil, newRoot)
+	assert.Nil(t, err)
+	assert.Equal(t, 300, len(all.Additions))
+	assert.Nil(t, verifier.VerifyConsistency(nil, newRoot, all))
+
+	// modifying or removing a key of the old root can't be proved
+	modified, _ := tr.Clone()
+	modified.Put(key(7), []byte("forged"))
+	_, err = tr.ProveConsistency(oldRoot, modified.RootHash())
+	assert.Equal(t, ErrNotAppendOnly, err)
+	removed, _ := tr.Clone()
+	removed.Del(key(7))
+	_, err = tr.ProveConsistency(oldRoot, removed.RootHash())
+	assert.Equal(t, ErrNotAppendOnly, err)
+	_, err = tr.ProveConsistency(newRoot, oldRoot)
+	assert.Equal(t, ErrNotAppendOnly, err)
+
+	// nor slipped in as an addition
+	forged := append([]KV{{Key: key(7), Value: []byte("forged")}}, proof.Additions...)
+	transition, err := tr.ProveTransition(oldRoot, modified.RootHash(), forged)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrKeyNotAdded, verifier.VerifyConsistency(oldRoot, modified.RootHash(),
+		&ConsistencyProof{Additions: forged, Transition: transition}))
+
+	deleted := append([]KV{{Key: key(7)}}, proof.Additions...)
+	transition, err = tr.ProveTransition(oldRoot, removed.RootHash(), deleted)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrNotAppendOnly, verifier.VerifyConsistency(oldRoot, removed.RootHash(),
+		&ConsistencyProof{Additions: deleted, Transition: transition}))
+
+	assert.Equal(t, ErrMalformedProof, verifier.VerifyConsistency(oldRoot, newRoot, nil))
+}
@@ -0,0 +1,220 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"errors"
+	"reflect"
+)
+
+// CopyFrom copy all the key value pairs under prefix in src into the trie.
+// If the trie has no keys in the sub-trie of src holding the prefix, the sub-trie
+// is spliced in by hash, its nodes are shared when both tries use the same storage
+// and copied as is otherwise. The pairs are put one by one when the sub-tries overlap.
+func (t *Trie) CopyFrom(src *Trie, prefix []byte) error {
+	subRoot, route, err := src.getSubTrieWithMaxCommonPrefix(prefix)
+	if err == ErrNotFound || (err == nil && len(subRoot) == 0) {
+		// no key under the prefix
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if reflect.TypeOf(t.serializer) == reflect.TypeOf(src.serializer) {
+		subNode, err := src.fetchNode(subRoot)
+		if err != nil {
+			return err
+		}
+		newHash, ok, err := t.graft(t.rootHash, route, subNode)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if t.storage != src.storage {
+				if err := src.copyNodes(subRoot, t); err != nil {
+					return err
+				}
+			}
+			if t.versioning {
+				if err := src.walk(subRoot, route, func(key, value []byte) error {
+					return t.recordVersion(newHash, key)
+				}); err != nil {
+					return err
+				}
+			}
+			t.rootHash = newHash
+			if t.needChangelog {
+				return src.walk(subRoot, route, func(key, value []byte) error {
+					t.changelog = append(t.changelog, &Entry{Update, key, nil, value})
+					return nil
+				})
+			}
+			return nil
+		}
+	}
+
+	return src.walk(subRoot, route, func(key, value []byte) error {
+		_, err := t.Put(key, value)
+		return err
+	})
+}
+
+// graft put the sub-trie sub at route, the returned flag is false and nothing is
+// written if the trie already has keys under route
+func (t *Trie) graft(root []byte, route []byte, sub *node) ([]byte, bool, error) {
+	if len(root) == 0 {
+		newHash, err := t.pathNode(route, sub)
+		return newHash, err == nil, err
+	}
+	rootNode, err := t.fetchNode(root)
+	if err != nil {
+		return nil, false, err
+	}
+	flag, err := rootNode.Type()
+	if err != nil {
+		return nil, false, err
+	}
+	switch flag {
+	case branch:
+		if len(route) == 0 {
+			return nil, false, nil
+		}
+		newHash, ok, err := t.graft(rootNode.Val[route[0]], route[1:], sub)
+		if !ok || err != nil {
+			return nil, ok, err
+		}
+		rootNode.Val[route[0]] = newHash
+		if err := t.commitNode(rootNode); err != nil {
+			return nil, false, err
+		}
+		return rootNode.Hash, true, nil
+	case ext:
+		path, next := rootNode.Val[1], rootNode.Val[2]
+		matchLen := prefixLen(path, route)
+		if matchLen == len(path) {
+			newHash, ok, err := t.graft(next, route[matchLen:], sub)
+			if !ok || err != nil {
+				return nil, ok, err
+			}
+			rootNode.Val[2] = newHash
+			if err := t.commitNode(rootNode); err != nil {
+				return nil, false, err
+			}
+			return rootNode.Hash, true, nil
+		}
+		if matchLen == len(route) {
+			return nil, false, nil
+		}
+		nextNode, err := t.fetchNode(next)
+		if err != nil {
+			return nil, false, err
+		}
+		rest, err := t.pathNode(path[matchLen+1:], nextNode)
+		if err != nil {
+			return nil, false, err
+		}
+		return t.graftSplit(path, rest, route, matchLen, sub)
+	case leaf:
+		path := rootNode.Val[1]
+		matchLen := prefixLen(path, route)
+		if matchLen == len(route) || matchLen == len(path) {
+			return nil, false, nil
+		}
+		rest, err := t.createNode([][]byte{[]byte{byte(leaf)}, append([]byte{}, path[matchLen+1:]...), rootNode.Val[2]})
+		if err != nil {
+			return nil, false, err
+		}
+		return t.graftSplit(path, rest.Hash, route, matchLen, sub)
+	default:
+		return nil, false, errors.New("unknown node type")
+	}
+}
+
+// graftSplit create the branch where path and route diverge at matchLen, holding
+// rest, the remains of the node of path, and sub
+func (t *Trie) graftSplit(path []byte, rest []byte, route []byte, matchLen int, sub *node) ([]byte, bool, error) {
+	var err error
+	brNode := emptyBranchNode()
+	brNode.Val[path[matchLen]] = rest
+	if brNode.Val[route[matchLen]], err = t.pathNode(route[matchLen+1:], sub); err != nil {
+		return nil, false, err
+	}
+	if err := t.commitNode(brNode); err != nil {
+		return nil, false, err
+	}
+	if matchLen == 0 {
+		return brNode.Hash, true, nil
+	}
+	extNode, err := t.createNode([][]byte{[]byte{byte(ext)}, append([]byte{}, path[:matchLen]...), brNode.Hash})
+	if err != nil {
+		return nil, false, err
+	}
+	return extNode.Hash, true, nil
+}
+
+// pathNode return the hash of the node reaching child through path,
+// the path is merged into child if it's a leaf or an ext node
+func (t *Trie) pathNode(path []byte, child *node) ([]byte, error) {
+	if len(path) == 0 {
+		return child.Hash, nil
+	}
+	flag, err := child.Type()
+	if err != nil {
+		return nil, err
+	}
+	var val [][]byte
+	switch flag {
+	case branch:
+		val = [][]byte{[]byte{byte(ext)}, append([]byte{}, path...), child.Hash}
+	case ext, leaf:
+		merged := append(append([]byte{}, path...), child.Val[1]...)
+		val = [][]byte{[]byte{byte(flag)}, merged, child.Val[2]}
+	default:
+		return nil, errors.New("unknown node type")
+	}
+	n, err := t.createNode(val)
+	if err != nil {
+		return nil, err
+	}
+	return n.Hash, nil
+}
+
+// copyNodes put the nodes of the sub-trie at rootHash into the storage of dst,
+// sub-tries already in the storage are skipped
+func (t *Trie) copyNodes(rootHash []byte, dst *Trie) error {
+	if _, err := dst.storage.Get(rootHash); err == nil {
+		return nil
+	}
+	n, err := t.fetchNode(rootHash)
+	if err != nil {
+		return err
+	}
+	children, err := n.children()
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := t.copyNodes(child, dst); err != nil {
+			return err
+		}
+	}
+	// the node is put after its children, so a node in storage has a complete sub-trie
+	return dst.storage.Put(rootHash, n.Bytes)
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCopySource(t *testing.T) *Trie {
+	stor, _ := storage.NewMemoryStorage()
+	src, _ := NewTrie(nil, stor, false)
+	src.Put([]byte("aaaa"), []byte("value1"))
+	src.Put([]byte("abbb"), []byte("value2"))
+	src.Put([]byte("abcc"), []byte("value3"))
+	src.Put([]byte("abdd"), []byte("value4"))
+	src.Put([]byte("bbbb"), []byte("value5"))
+	return src
+}
+
+// expectTrie build a trie with the pairs put one by one
+func expectTrie(pairs ...string) *Trie {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	for i := 0; i < len(pairs); i += 2 {
+		tr.Put([]byte(pairs[i]), []byte(pairs[i+1]))
+	}
+	return tr
+}
+
+func TestTrie_CopyFromSharedStorage(t *testing.T) {
+	src := newCopySource(t)
+	dst, _ := NewTrie(nil, src.storage, false)
+
+	assert.Nil(t, dst.CopyFrom(src, []byte("ab")))
+	expect := expectTrie("abbb", "value2", "abcc", "value3", "abdd", "value4")
+	assert.Equal(t, expect.RootHash(), dst.RootHash())
+
+	_, err := dst.Get([]byte("aaaa"))
+	assert.Equal(t, ErrNotFound, err)
+	for _, key := range []string{"abbb", "abcc", "abdd"} {
+		srcProof, err := src.Prove([]byte(key))
+		assert.Nil(t, err)
+		dstProof, err := dst.Prove([]byte(key))
+		assert.Nil(t, err)
+		assert.Nil(t, dst.Verify(dst.RootHash(), []byte(key), dstProof))
+		// the nodes below the spliced sub-trie are shared
+		assert.Equal(t, srcProof[len(srcProof)-2:], dstProof[len(dstProof)-2:])
+	}
+}
+
+func TestTrie_CopyFromSplit(t *testing.T) {
+	src := newCopySource(t)
+
+	// the pairs of dst diverge from the prefix at a leaf, an ext node and a branch
+	for _, pairs := range [][]string{
+		{"cccc", "other1"},
+		{"accc", "other1", "acdd", "other2"},
+		{"cccc", "other1", "dddd", "other2"},
+	} {
+		stor, _ := storage.NewMemoryStorage()
+		dst, _ := NewTrie(nil, stor, false)
+		for i := 0; i < len(pairs); i += 2 {
+			dst.Put([]byte(pairs[i]), []byte(pairs[i+1]))
+		}
+
+		assert.Nil(t, dst.CopyFrom(src, []byte("ab")))
+		expect := expectTrie(append(pairs, "abbb", "value2", "abcc", "value3", "abdd", "value4")...)
+		assert.Equal(t, expect.RootHash(), dst.RootHash(), "%v", pairs)
+
+		for _, key := range []string{"abbb", "abcc", "abdd"} {
+			proof, err := dst.Prove([]byte(key))
+			assert.Nil(t, err)
+			expectProof, _ := expect.Prove([]byte(key))
+			assert.Equal(t, expectProof, proof)
+		}
+		// the nodes are copied into the storage of dst
+		count := 0
+		assert.Nil(t, dst.Walk(func(key, value []byte) error {
+			count++
+			return nil
+		}))
+		assert.Equal(t, len(pairs)/2+3, count)
+	}
+}
+
+func TestTrie_CopyFromOverlap(t *testing.T) {
+	src := newCopySource(t)
+	dst := expectTrie("abcc", "old", "abzz", "other")
+
+	assert.Nil(t, dst.CopyFrom(src, []byte("ab")))
+	expect := expectTrie("abzz", "other", "abbb", "value2", "abcc", "value3", "abdd", "value4")
+	assert.Equal(t, expect.RootHash(), dst.RootHash())
+
+	// a different serializer can't share nodes
+	stor, _ := storage.NewMemoryStorage()
+	jsonDst, _ := NewTrieWithSerializer(nil, stor, false, &JSONSerializer{})
+	assert.Nil(t, jsonDst.CopyFrom(src, []byte("ab")))
+	val, err := jsonDst.Get([]byte("abdd"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value4"), val)
+}
+
+func TestTrie_CopyFromEdgeCases(t *testing.T) {
+	src := newCopySource(t)
+
+	// no key under the prefix
+	dst := expectTrie("cccc", "other")
+	root := dst.RootHash()
+	assert.Nil(t, dst.CopyFrom(src, []byte("zz")))
+	assert.Equal(t, root, dst.RootHash())
+
+	// an empty prefix copies everything
+	stor, _ := storage.NewMemoryStorage()
+	all, _ := NewTrie(nil, stor, false)
+	assert.Nil(t, all.CopyFrom(src, nil))
+	assert.Equal(t, src.RootHash(), all.RootHash())
+
+	// a single key prefix
+	single := expectTrie("cccc", "other")
+	assert.Nil(t, single.CopyFrom(src, []byte("abdd")))
+	assert.Equal(t, expectTrie("cccc", "other", "abdd", "value4").RootHash(), single.RootHash())
+
+	// the copied pairs are in the changelog of dst
+	stor, _ = storage.NewMemoryStorage()
+	logged, _ := NewTrie(nil, stor, true)
+	assert.Nil(t, logged.CopyFrom(src, []byte("ab")))
+	replay := expectTrie()
+	_, err := replay.Replay(logged)
+	assert.Nil(t, err)
+	assert.Equal(t, logged.RootHash(), replay.RootHash())
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+)
+
+// CursorStep is a node on the path of a key
+type CursorStep struct {
+	// Flag is the type of the node, "branch", "ext" or "leaf"
+	Flag string
+	Hash []byte
+	// Node is the serialized node as it's in storage
+	Node []byte
+	// Child is the slot of the branch node followed by the path, -1 for the other nodes
+	// and for a branch node where the path ends
+	Child int
+}
+
+// Cursor walks the path of a key from the root one node at a time,
+// the nodes are fetched lazily by Next
+type Cursor struct {
+	trie  *Trie
+	next  []byte
+	route []byte
+	depth int
+	limit int
+	step  *CursorStep
+	value []byte
+	found bool
+}
+
+// NewCursor return a cursor on the path of the key, the first node is the root
+func (t *Trie) NewCursor(key []byte) *Cursor {
+	route := keyToRoute(key)
+	c := &Cursor{
+		trie:  t,
+		route: route,
+		limit: t.proofDepthLimit(route),
+	}
+	if !t.Empty() {
+		c.next = t.rootHash
+	}
+	return c
+}
+
+// Next fetch the next node on the path, return false when the path ended
+func (c *Cursor) Next() (bool, error) {
+	if len(c.next) == 0 {
+		return false, nil
+	}
+	if c.depth >= c.limit {
+		return false, ErrProofTooDeep
+	}
+	n, err := c.trie.fetchNode(c.next)
+	if err != nil {
+		return false, err
+	}
+	flag, err := n.Type()
+	if err != nil {
+		return false, err
+	}
+
+	step := &CursorStep{Flag: flag.String(), Hash: n.Hash, Node: n.Bytes, Child: -1}
+	c.next = nil
+	switch flag {
+	case branch:
+		if len(c.route) > 0 {
+			step.Child = int(c.route[0])
+			c.next = n.Val[c.route[0]]
+			c.route = c.route[1:]
+		}
+	case ext:
+		path := n.Val[1]
+		if prefixLen(path, c.route) == len(path) {
+			c.next = n.Val[2]
+			c.route = c.route[len(path):]
+		}
+	case leaf:
+		if bytes.Equal(n.Val[1], c.route) {
+			c.found = true
+			c.value = n.Val[2]
+		}
+	default:
+		return false, errors.New("unknown node type")
+	}
+	c.depth++
+	c.step = step
+	return true, nil
+}
+
+// Step return the node fetched by the last Next
+func (c *Cursor) Step() *CursorStep {
+	return c.step
+}
+
+// Found return whether the path ended at the leaf of the key
+func (c *Cursor) Found() bool {
+	return c.found
+}
+
+// Value return the value of the key if Found
+func (c *Cursor) Value() []byte {
+	return c.value
+}
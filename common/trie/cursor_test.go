@@ -0,0 +1,111 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// getCounter count the gets from the storage
+type getCounter struct {
+	storage.Storage
+	gets int
+}
+
+func (s *getCounter) Get(key []byte) ([]byte, error) {
+	s.gets++
+	return s.Storage.Get(key)
+}
+
+func TestTrie_Cursor(t *testing.T) {
+	mem, _ := storage.NewMemoryStorage()
+	stor := &getCounter{Storage: mem}
+	tr, _ := NewTrie(nil, stor, false)
+
+	c := tr.NewCursor([]byte("aaaa"))
+	ok, err := c.Next()
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abdd"), []byte("bbbb")}
+	for i, key := range keys {
+		tr.Put(key, []byte{byte(i)})
+	}
+
+	for i, key := range keys {
+		proof, err := tr.Prove(key)
+		assert.Nil(t, err)
+
+		stor.gets = 0
+		c := tr.NewCursor(key)
+		steps := make([]*CursorStep, 0)
+		for {
+			ok, err := c.Next()
+			assert.Nil(t, err)
+			if !ok {
+				break
+			}
+			// one node is fetched per step
+			steps = append(steps, c.Step())
+			assert.Equal(t, len(steps), stor.gets)
+		}
+		assert.True(t, c.Found())
+		assert.Equal(t, []byte{byte(i)}, c.Value())
+		assert.Equal(t, len(proof), len(steps))
+
+		route := keyToRoute(key)
+		for j, step := range steps {
+			assert.Equal(t, hash.Sha3256(step.Node), step.Hash)
+			val, err := tr.serializer.Deserialize(step.Node)
+			assert.Nil(t, err)
+			assert.Equal(t, proof[j], val)
+			switch step.Flag {
+			case "branch":
+				assert.Equal(t, int(route[0]), step.Child)
+				route = route[1:]
+			case "ext":
+				assert.Equal(t, -1, step.Child)
+				route = route[len(val[1]):]
+			default:
+				assert.Equal(t, "leaf", step.Flag)
+				assert.Equal(t, route, val[1])
+			}
+		}
+		assert.Equal(t, tr.RootHash(), steps[0].Hash)
+	}
+
+	// the path of a missing key ends where it leaves the trie
+	c = tr.NewCursor([]byte("abcc"))
+	count := 0
+	for {
+		ok, err := c.Next()
+		assert.Nil(t, err)
+		if !ok {
+			break
+		}
+		count++
+	}
+	assert.True(t, count > 0)
+	assert.False(t, c.Found())
+	assert.Nil(t, c.Value())
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"errors"
+
+	"github.com/nebulasio/go-nebulas/storage"
+)
+
+// Errors
+var (
+	ErrIncompleteContents = errors.New("pairs are not the complete contents of the trie")
+	ErrDuplicateKey       = errors.New("pairs contain a duplicate key")
+)
+
+// FullProof proves that a list of pairs is the complete contents of the trie at Root
+type FullProof struct {
+	Root  []byte
+	Count int
+}
+
+// ProveAll return all the key value pairs of the trie in key order, with a proof
+// that no key is omitted. Only meant for small tries, all pairs are loaded at once.
+func (t *Trie) ProveAll() ([][2][]byte, *FullProof, error) {
+	pairs := make([][2][]byte, 0)
+	err := t.Walk(func(key, value []byte) error {
+		pairs = append(pairs, [2][]byte{key, value})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pairs, &FullProof{Root: t.rootHash, Count: len(pairs)}, nil
+}
+
+// VerifyAll verify that pairs are exactly the contents of the trie at rootHash by
+// rebuilding the trie from the pairs, an omitted, added or altered pair changes the root.
+// ErrMalformedProof is returned for a nil proof or a negative count.
+func (t *Trie) VerifyAll(rootHash []byte, pairs [][2][]byte, proof *FullProof) error {
+	if proof == nil || proof.Count < 0 {
+		return ErrMalformedProof
+	}
+	if !sameRoot(rootHash, proof.Root) || proof.Count != len(pairs) {
+		return ErrIncompleteContents
+	}
+
+	stor, err := storage.NewMemoryStorage()
+	if err != nil {
+		return err
+	}
+	tr, err := NewTrieWithSerializer(nil, stor, false, t.serializer)
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if _, err := tr.Get(pair[0]); err == nil {
+			return ErrDuplicateKey
+		}
+		if _, err := tr.Put(pair[0], pair[1]); err != nil {
+			return err
+		}
+	}
+	if !sameRoot(rootHash, tr.rootHash) {
+		return ErrIncompleteContents
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_ProveAll(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+	tr.Put([]byte("bbbb"), []byte("value4"))
+	tr.Put([]byte("cccc"), []byte("value5"))
+	tr.Del([]byte("abcc"))
+	tr.Del([]byte("cccc"))
+	root := tr.RootHash()
+
+	pairs, proof, err := tr.ProveAll()
+	assert.Nil(t, err)
+	assert.Equal(t, [][2][]byte{
+		{[]byte("aaaa"), []byte("value1")},
+		{[]byte("abbb"), []byte("value2")},
+		{[]byte("bbbb"), []byte("value4")},
+	}, pairs)
+	assert.Nil(t, tr.VerifyAll(root, pairs, proof))
+
+	// the order of the pairs doesn't matter
+	reversed := [][2][]byte{pairs[2], pairs[1], pairs[0]}
+	assert.Nil(t, tr.VerifyAll(root, reversed, proof))
+
+	// an omitted pair
+	assert.Equal(t, ErrIncompleteContents, tr.VerifyAll(root, pairs[1:], proof))
+	assert.Equal(t, ErrIncompleteContents, tr.VerifyAll(root, pairs[1:], &FullProof{Root: root, Count: 2}))
+	// an altered pair
+	altered := [][2][]byte{pairs[0], {[]byte("abbb"), []byte("forged")}, pairs[2]}
+	assert.Equal(t, ErrIncompleteContents, tr.VerifyAll(root, altered, proof))
+	// an added pair
+	added := append([][2][]byte{{[]byte("dddd"), []byte("extra")}}, pairs...)
+	assert.Equal(t, ErrIncompleteContents, tr.VerifyAll(root, added, &FullProof{Root: root, Count: 4}))
+	// a duplicated key with the right final value
+	duplicated := [][2][]byte{{[]byte("aaaa"), []byte("stale")}, pairs[0], pairs[1], pairs[2]}
+	assert.Equal(t, ErrDuplicateKey, tr.VerifyAll(root, duplicated, &FullProof{Root: root, Count: 4}))
+	// another root
+	assert.Equal(t, ErrIncompleteContents, tr.VerifyAll([]byte("other root"), pairs, proof))
+}
+
+func TestTrie_ProveAllEmpty(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrieWithSerializer(nil, stor, false, &JSONSerializer{})
+	pairs, proof, err := tr.ProveAll()
+	assert.Nil(t, err)
+	assert.Empty(t, pairs)
+	assert.Nil(t, tr.VerifyAll(EmptyRootHash(), pairs, proof))
+
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	pairs, proof, err = tr.ProveAll()
+	assert.Nil(t, err)
+	assert.Nil(t, tr.VerifyAll(tr.RootHash(), pairs, proof))
+	assert.Equal(t, ErrIncompleteContents, tr.VerifyAll(tr.RootHash(), nil, &FullProof{Root: tr.RootHash()}))
+
+	// malformed proofs are rejected, not dereferenced
+	assert.Equal(t, ErrMalformedProof, tr.VerifyAll(tr.RootHash(), pairs, nil))
+	assert.Equal(t, ErrMalformedProof, tr.VerifyAll(EmptyRootHash(), nil, nil))
+	assert.Equal(t, ErrMalformedProof, tr.VerifyAll(tr.RootHash(), pairs, &FullProof{Root: tr.RootHash(), Count: -1}))
+}
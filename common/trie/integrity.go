@@ -0,0 +1,98 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// CorruptNodeError is a node whose content doesn't hash to the key it is stored under
+type CorruptNodeError struct {
+	Hash   []byte
+	Actual []byte
+}
+
+func (e *CorruptNodeError) Error() string {
+	return "corrupt trie node " + byteutils.Hex(e.Hash) + ", content hashes to " + byteutils.Hex(e.Actual)
+}
+
+// ValidateIntegrity re-hash every node reachable from the root and
+// return the first *CorruptNodeError, or the error of a missing or undecodable node
+func (t *Trie) ValidateIntegrity() error {
+	var first error
+	t.validateIntegrity(func(err error) bool {
+		first = err
+		return false
+	})
+	return first
+}
+
+// ValidateIntegrityAll re-hash every node reachable from the root and return all the errors found,
+// the children of a corrupt node are still checked if it can be decoded
+func (t *Trie) ValidateIntegrityAll() []error {
+	var errs []error
+	t.validateIntegrity(func(err error) bool {
+		errs = append(errs, err)
+		return true
+	})
+	return errs
+}
+
+// validateIntegrity walk the trie and report errors to fn, stop if fn returns false
+func (t *Trie) validateIntegrity(fn func(err error) bool) {
+	if t.Empty() {
+		return
+	}
+	hashes := [][]byte{t.rootHash}
+	for len(hashes) > 0 {
+		h := hashes[0]
+		hashes = hashes[1:]
+
+		ir, err := t.storage.Get(h)
+		if err != nil {
+			if !fn(err) {
+				return
+			}
+			continue
+		}
+		if actual := hash.Sha3256(ir); !bytes.Equal(h, actual) {
+			if !fn(&CorruptNodeError{Hash: h, Actual: actual}) {
+				return
+			}
+		}
+		val, err := t.serializer.Deserialize(ir)
+		if err != nil {
+			if !fn(err) {
+				return
+			}
+			continue
+		}
+		children, err := (&node{Val: val}).children()
+		if err != nil {
+			if !fn(err) {
+				return
+			}
+			continue
+		}
+		hashes = append(hashes, children...)
+	}
+}
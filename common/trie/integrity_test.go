@@ -0,0 +1,65 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_ValidateIntegrity(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	assert.Nil(t, tr.ValidateIntegrity())
+
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+	assert.Nil(t, tr.ValidateIntegrity())
+	assert.Equal(t, 0, len(tr.ValidateIntegrityAll()))
+
+	// overwrite two leaves with the content of another leaf
+	leafHash := func(key []byte) []byte {
+		proof, _ := tr.Prove(key)
+		ir, _ := tr.serializer.Serialize(proof[len(proof)-1])
+		return hash.Sha3256(ir)
+	}
+	hashB := leafHash([]byte("abbb"))
+	hashC := leafHash([]byte("abcc"))
+	content, _ := stor.Get(leafHash([]byte("aaaa")))
+	stor.Put(hashB, content)
+	stor.Put(hashC, content)
+
+	err := tr.ValidateIntegrity()
+	corrupt, ok := err.(*CorruptNodeError)
+	assert.True(t, ok)
+	assert.Contains(t, [][]byte{hashB, hashC}, corrupt.Hash)
+
+	errs := tr.ValidateIntegrityAll()
+	assert.Equal(t, 2, len(errs))
+
+	// a missing node is reported too
+	stor.Del(hashB)
+	errs = tr.ValidateIntegrityAll()
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, storage.ErrKeyNotFound, errs[0])
+}
@@ -19,6 +19,7 @@
 package trie
 
 import (
+	"bytes"
 	"errors"
 
 	"github.com/nebulasio/go-nebulas/crypto/hash"
@@ -26,7 +27,10 @@ import (
 
 // errors constants
 var (
-	ErrNotIterable = errors.New("leaf node is not iterable")
+	ErrNotIterable      = errors.New("leaf node is not iterable")
+	ErrPause            = errors.New("chunked walk paused")
+	ErrInvalidChunkSize = errors.New("chunk size must be positive")
+	errRangeLimit       = errors.New("range limit reached")
 )
 
 // IteratorState represents the intermediate statue in iterator
@@ -50,7 +54,7 @@ func validElementsInBranchNode(offset int, node *node) []int {
 	if ty != branch {
 		return valid
 	}
-	for i := offset; i < 16; i++ {
+	for i := offset; i < branchWidth; i++ {
 		if node.Val[i] != nil && len(node.Val[i]) > 0 {
 			valid = append(valid, i)
 		}
@@ -83,6 +87,68 @@ func (t *Trie) Iterator(prefix []byte) (*Iterator, error) {
 	}, nil
 }
 
+// NewIteratorFrom return an iterator over the keys >= start in key order, the iterator
+// descends to start directly instead of skipping the keys before it. To resume after a key,
+// start from the key followed by a zero byte.
+func (t *Trie) NewIteratorFrom(start []byte) (*Iterator, error) {
+	it := &Iterator{root: t, stack: []*IteratorState{}}
+	if t.Empty() {
+		return it, nil
+	}
+	curRoute := keyToRoute(start)
+	route := []byte{}
+	curHash := t.rootHash
+	for {
+		node, err := t.fetchNode(curHash)
+		if err != nil {
+			return nil, err
+		}
+		flag, err := node.Type()
+		if err != nil {
+			return nil, err
+		}
+		switch flag {
+		case branch:
+			if len(curRoute) == 0 {
+				it.push(node, 0, route)
+				return it, nil
+			}
+			// the later slots are visited after the sub-trie of start
+			slot := int(curRoute[0])
+			if len(validElementsInBranchNode(slot+1, node)) > 0 {
+				it.push(node, slot+1, route)
+			}
+			if len(node.Val[slot]) == 0 {
+				return it, nil
+			}
+			curHash = node.Val[slot]
+			route = append(append([]byte{}, route...), byte(slot))
+			curRoute = curRoute[1:]
+		case ext:
+			path := node.Val[1]
+			matchLen := prefixLen(path, curRoute)
+			if matchLen == len(path) {
+				curHash = node.Val[2]
+				route = append(append([]byte{}, route...), path...)
+				curRoute = curRoute[matchLen:]
+				continue
+			}
+			// the whole sub-trie is either after or before start
+			if matchLen == len(curRoute) || path[matchLen] > curRoute[matchLen] {
+				it.push(node, 0, route)
+			}
+			return it, nil
+		case leaf:
+			if bytes.Compare(node.Val[1], curRoute) >= 0 {
+				it.push(node, 0, route)
+			}
+			return it, nil
+		default:
+			return nil, errors.New("unknown node type")
+		}
+	}
+}
+
 func (t *Trie) getSubTrieWithMaxCommonPrefix(prefix []byte) ([]byte, []byte, error) {
 	curRootHash := t.rootHash
 	curRoute := keyToRoute(prefix)
@@ -199,6 +265,190 @@ func (it *Iterator) Value() []byte {
 	return it.value
 }
 
+// Walk visits every key/value pair in the trie in key order,
+// stops and returns the error as soon as fn returns an error
+func (t *Trie) Walk(fn func(key, value []byte) error) error {
+	if t.Empty() {
+		return nil
+	}
+	return t.walk(t.rootHash, []byte{}, fn)
+}
+
+func (t *Trie) walk(rootHash []byte, route []byte, fn func(key, value []byte) error) error {
+	rootNode, err := t.fetchNode(rootHash)
+	if err != nil {
+		return err
+	}
+	flag, err := rootNode.Type()
+	if err != nil {
+		return err
+	}
+	switch flag {
+	case branch:
+		for i := 0; i < branchWidth; i++ {
+			if len(rootNode.Val[i]) == 0 {
+				continue
+			}
+			if err := t.walk(rootNode.Val[i], append(route, byte(i)), fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ext:
+		return t.walk(rootNode.Val[2], append(route, rootNode.Val[1]...), fn)
+	case leaf:
+		key := routeToKey(append(route, rootNode.Val[1]...))
+		return fn(key, rootNode.Val[2])
+	default:
+		return errors.New("unknown node type")
+	}
+}
+
+// ForEachChunk walk the trie in key order, calling fn with up to chunkSize key/value pairs at a time.
+// fn can return ErrPause to stop after the chunk, it's then returned, use ForEachFrom to resume later.
+func (t *Trie) ForEachChunk(chunkSize int, fn func(kvs [][2][]byte) error) error {
+	next, err := t.ForEachFrom(nil, chunkSize, fn)
+	if err == nil && next != nil {
+		return ErrPause
+	}
+	return err
+}
+
+// ForEachFrom walk the keys >= start like ForEachChunk. If fn returns ErrPause, the walk stops
+// and the key to resume from is returned, it's nil if the paused chunk was the last one.
+// The walk ends with a nil key and error.
+func (t *Trie) ForEachFrom(start []byte, chunkSize int, fn func(kvs [][2][]byte) error) ([]byte, error) {
+	if chunkSize <= 0 {
+		return nil, ErrInvalidChunkSize
+	}
+	it, err := t.NewIteratorFrom(start)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := make([][2][]byte, 0, chunkSize)
+	for {
+		ok, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ok && len(chunk) < chunkSize {
+			chunk = append(chunk, [2][]byte{it.Key(), it.Value()})
+			continue
+		}
+		// the chunk is full or the walk is done, a full chunk was followed by the key to resume from
+		if len(chunk) > 0 {
+			if err := fn(chunk); err == ErrPause {
+				if ok {
+					return it.Key(), nil
+				}
+				return nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if !ok {
+			return nil, nil
+		}
+		// fn may keep the chunk, the next one gets its own slice
+		chunk = make([][2][]byte, 0, chunkSize)
+		chunk = append(chunk, [2][]byte{it.Key(), it.Value()})
+	}
+}
+
+// GetRange return up to limit key value pairs with start <= key <= end in ascending order,
+// nil start or end leaves the interval open on that side, limit <= 0 means no limit.
+// Sub-tries outside the interval are never visited.
+func (t *Trie) GetRange(start, end []byte, limit int) ([][]byte, [][]byte, error) {
+	keys, values := [][]byte{}, [][]byte{}
+	if t.Empty() {
+		return keys, values, nil
+	}
+	var startRoute, endRoute []byte
+	if start != nil {
+		startRoute = keyToRoute(start)
+	}
+	if end != nil {
+		endRoute = keyToRoute(end)
+	}
+	err := t.rangeWalk(t.rootHash, []byte{}, startRoute, endRoute, func(key, value []byte) error {
+		if start != nil && bytes.Compare(key, start) < 0 {
+			return nil
+		}
+		if end != nil && bytes.Compare(key, end) > 0 {
+			return nil
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+		if limit > 0 && len(keys) >= limit {
+			return errRangeLimit
+		}
+		return nil
+	})
+	if err != nil && err != errRangeLimit {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+// inRange return whether the sub-trie at route may contain keys between startRoute and endRoute
+func inRange(route, startRoute, endRoute []byte) bool {
+	if startRoute != nil {
+		n := len(route)
+		if n > len(startRoute) {
+			n = len(startRoute)
+		}
+		if bytes.Compare(route[:n], startRoute[:n]) < 0 {
+			return false
+		}
+	}
+	if endRoute != nil {
+		n := len(route)
+		if n > len(endRoute) {
+			n = len(endRoute)
+		}
+		if bytes.Compare(route[:n], endRoute[:n]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *Trie) rangeWalk(rootHash []byte, route []byte, startRoute, endRoute []byte, fn func(key, value []byte) error) error {
+	if !inRange(route, startRoute, endRoute) {
+		return nil
+	}
+	rootNode, err := t.fetchNode(rootHash)
+	if err != nil {
+		return err
+	}
+	flag, err := rootNode.Type()
+	if err != nil {
+		return err
+	}
+	switch flag {
+	case branch:
+		for i := 0; i < branchWidth; i++ {
+			if len(rootNode.Val[i]) == 0 {
+				continue
+			}
+			child := append(append([]byte{}, route...), byte(i))
+			if err := t.rangeWalk(rootNode.Val[i], child, startRoute, endRoute, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ext:
+		child := append(append([]byte{}, route...), rootNode.Val[1]...)
+		return t.rangeWalk(rootNode.Val[2], child, startRoute, endRoute, fn)
+	case leaf:
+		key := routeToKey(append(append([]byte{}, route...), rootNode.Val[1]...))
+		return fn(key, rootNode.Val[2])
+	default:
+		return errors.New("unknown node type")
+	}
+}
+
 // HashDomains for each variable in contract
 // each domain will represented as 6 bytes, support 4 level domain at most
 // such as,
@@ -19,7 +19,10 @@
 package trie
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strconv"
 	"testing"
 
 	"github.com/gogo/protobuf/proto"
@@ -199,3 +202,236 @@ func TestIteratorEmpty(t *testing.T) {
 	assert.Nil(t, iter)
 	assert.Equal(t, err, storage.ErrKeyNotFound)
 }
+
+func TestTrie_Walk(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	assert.Nil(t, tr.Walk(func(key, value []byte) error {
+		return errors.New("should not be called")
+	}))
+
+	names := []string{"123450", "123350", "122450", "223350", "133350"}
+	for _, v := range names {
+		key, _ := byteutils.FromHex(v)
+		tr.Put(key, []byte(v))
+	}
+
+	visited := []string{}
+	err := tr.Walk(func(key, value []byte) error {
+		assert.Equal(t, byteutils.Hex(key), string(value))
+		visited = append(visited, string(value))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"122450", "123350", "123450", "133350", "223350"}, visited)
+
+	stop := errors.New("stop")
+	count := 0
+	err = tr.Walk(func(key, value []byte) error {
+		count++
+		if count == 2 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestTrie_GetRange(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys, values, err := tr.GetRange(nil, nil, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Equal(t, 0, len(values))
+
+	all := []string{"aaaa", "abbb", "abcc", "acdd", "bbbb", "bcde", "cccc"}
+	for _, key := range all {
+		tr.Put([]byte(key), []byte("v"+key))
+	}
+	collect := func(start, end []byte, limit int) []string {
+		keys, values, err := tr.GetRange(start, end, limit)
+		assert.Nil(t, err)
+		result := []string{}
+		for i, key := range keys {
+			assert.Equal(t, "v"+string(key), string(values[i]))
+			result = append(result, string(key))
+		}
+		return result
+	}
+
+	assert.Equal(t, all, collect(nil, nil, 0))
+	assert.Equal(t, all[1:5], collect([]byte("abbb"), []byte("bbbb"), 0))
+	assert.Equal(t, all[1:3], collect([]byte("abbb"), []byte("bbbb"), 2))
+	assert.Equal(t, all[2:4], collect([]byte("abca"), []byte("acde"), 0))
+	assert.Equal(t, all[4:], collect([]byte("b"), nil, 0))
+	assert.Equal(t, all[:2], collect(nil, []byte("abc"), 0))
+	assert.Equal(t, []string{}, collect([]byte("dddd"), nil, 0))
+	assert.Equal(t, []string{}, collect([]byte("bbbc"), []byte("bcdd"), 0))
+
+	// sub-tries outside the range are not visited
+	reader := &countingReader{stor: stor}
+	prover, _ := NewProver(tr.RootHash(), reader)
+	prover.GetRange(nil, nil, 0)
+	full := reader.reads
+	reader.reads = 0
+	prover.GetRange([]byte("cccc"), nil, 0)
+	assert.True(t, reader.reads < full)
+}
+
+func iterateAll(t *testing.T, it *Iterator, limit int) [][]byte {
+	keys := [][]byte{}
+	for limit <= 0 || len(keys) < limit {
+		ok, err := it.Next()
+		assert.Nil(t, err)
+		if !ok {
+			break
+		}
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+func TestTrie_NewIteratorFrom(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+
+	it, err := tr.NewIteratorFrom([]byte("aaaa"))
+	assert.Nil(t, err)
+	assert.Empty(t, iterateAll(t, it, 0))
+
+	tr.Put([]byte("abcd"), []byte("value"))
+	it, err = tr.NewIteratorFrom([]byte("abcd"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("abcd")}, iterateAll(t, it, 0))
+	it, err = tr.NewIteratorFrom([]byte("abce"))
+	assert.Nil(t, err)
+	assert.Empty(t, iterateAll(t, it, 0))
+
+	for i := 0; i < 200; i++ {
+		key := hash.Sha3256([]byte(fmt.Sprint(i)))[:4]
+		tr.Put(key, key)
+	}
+	all := [][]byte{}
+	tr.Walk(func(key, value []byte) error {
+		all = append(all, key)
+		return nil
+	})
+
+	starts := [][]byte{nil, {}, {0x00}, {0xff, 0xff, 0xff, 0xff, 0xff}, []byte("abcd"), {0x80, 0x00}}
+	for i := 0; i < len(all); i += 13 {
+		starts = append(starts, all[i], append(append([]byte{}, all[i]...), 0), all[i][:2])
+	}
+	for _, start := range starts {
+		expect := [][]byte{}
+		for _, key := range all {
+			if bytes.Compare(key, start) >= 0 {
+				expect = append(expect, key)
+			}
+		}
+		it, err := tr.NewIteratorFrom(start)
+		assert.Nil(t, err)
+		assert.Equal(t, expect, iterateAll(t, it, 0), "start %x", start)
+	}
+}
+
+func TestTrie_NewIteratorFromPages(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	for i := 0; i < 100; i++ {
+		key := hash.Sha3256([]byte(fmt.Sprint(i)))
+		tr.Put(key, []byte(fmt.Sprint(i)))
+	}
+	it, err := tr.NewIteratorFrom(nil)
+	assert.Nil(t, err)
+	all := iterateAll(t, it, 0)
+	assert.Equal(t, 100, len(all))
+
+	// page N+1 starts right after the last key of page N
+	pages := [][]byte{}
+	var start []byte
+	for {
+		it, err := tr.NewIteratorFrom(start)
+		assert.Nil(t, err)
+		page := iterateAll(t, it, 7)
+		if len(page) == 0 {
+			break
+		}
+		assert.True(t, len(page) <= 7)
+		pages = append(pages, page...)
+		start = append(append([]byte{}, page[len(page)-1]...), 0)
+	}
+	assert.Equal(t, all, pages)
+}
+
+func TestTrie_ForEachChunk(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	_, err := tr.ForEachFrom(nil, 0, nil)
+	assert.Equal(t, ErrInvalidChunkSize, err)
+	assert.Nil(t, tr.ForEachChunk(3, func(kvs [][2][]byte) error {
+		t.Error("unexpected chunk")
+		return nil
+	}))
+
+	keys := make([][]byte, 0)
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%03d", i))
+		keys = append(keys, key)
+		tr.Put(key, []byte(strconv.Itoa(i)))
+	}
+
+	chunks := make([][][2][]byte, 0)
+	assert.Nil(t, tr.ForEachChunk(7, func(kvs [][2][]byte) error {
+		chunks = append(chunks, kvs)
+		return nil
+	}))
+	assert.Equal(t, 15, len(chunks))
+	walked := make([][]byte, 0)
+	for i, chunk := range chunks {
+		if i < 14 {
+			assert.Equal(t, 7, len(chunk))
+		}
+		for _, kv := range chunk {
+			walked = append(walked, kv[0])
+			value, _ := tr.Get(kv[0])
+			assert.Equal(t, value, kv[1])
+		}
+	}
+	assert.Equal(t, keys, walked)
+
+	// pause after every other chunk and resume from the saved cursor
+	walked = walked[:0]
+	var cursor []byte
+	pauses := 0
+	for {
+		calls := 0
+		next, err := tr.ForEachFrom(cursor, 10, func(kvs [][2][]byte) error {
+			for _, kv := range kvs {
+				walked = append(walked, kv[0])
+			}
+			calls++
+			if calls == 2 {
+				return ErrPause
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		if next == nil {
+			break
+		}
+		pauses++
+		cursor = next
+	}
+	assert.Equal(t, 4, pauses)
+	assert.Equal(t, keys, walked)
+
+	assert.Equal(t, ErrPause, tr.ForEachChunk(10, func(kvs [][2][]byte) error {
+		return ErrPause
+	}))
+	failed := errors.New("failed")
+	assert.Equal(t, failed, tr.ForEachChunk(10, func(kvs [][2][]byte) error {
+		return failed
+	}))
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"sync/atomic"
+
+	"github.com/nebulasio/go-nebulas/metrics"
+)
+
+// Metrics for proofs, depth and bytes are totals, divide them by the generated proofs for the averages
+var (
+	metricsProofGenerated = metrics.NewCounter("neb.trie.proof.generated")
+	metricsProofDepth     = metrics.NewCounter("neb.trie.proof.depth")
+	metricsProofBytes     = metrics.NewCounter("neb.trie.proof.bytes")
+	metricsProofCacheHit  = metrics.NewCounter("neb.trie.proof.cache.hit")
+	metricsProofCacheMiss = metrics.NewCounter("neb.trie.proof.cache.miss")
+)
+
+// ProofStats summarize the proofs generated by Prove
+type ProofStats struct {
+	Proofs       uint64
+	AvgDepth     float64
+	AvgBytes     float64
+	CacheHitRate float64
+}
+
+// proofCounters are updated atomically so that concurrent Prove calls don't contend
+type proofCounters struct {
+	proofs      uint64
+	depth       uint64
+	bytes       uint64
+	cacheHits   uint64
+	cacheMisses uint64
+}
+
+// ProofStats return the stats of the proofs generated by the trie,
+// the cache hit rate is 0 without a proof cache
+func (t *Trie) ProofStats() ProofStats {
+	stats := ProofStats{Proofs: atomic.LoadUint64(&t.counters.proofs)}
+	if stats.Proofs > 0 {
+		stats.AvgDepth = float64(atomic.LoadUint64(&t.counters.depth)) / float64(stats.Proofs)
+		stats.AvgBytes = float64(atomic.LoadUint64(&t.counters.bytes)) / float64(stats.Proofs)
+	}
+	hits, misses := t.ProofCacheStats()
+	if hits+misses > 0 {
+		stats.CacheHitRate = float64(hits) / float64(hits+misses)
+	}
+	return stats
+}
+
+// recordProof count the proof in the stats of the trie and the metrics
+func (t *Trie) recordProof(proof MerkleProof) {
+	size := 0
+	for _, val := range proof {
+		for _, v := range val {
+			size += len(v)
+		}
+	}
+	atomic.AddUint64(&t.counters.proofs, 1)
+	atomic.AddUint64(&t.counters.depth, uint64(len(proof)))
+	atomic.AddUint64(&t.counters.bytes, uint64(size))
+	metricsProofGenerated.Inc(1)
+	metricsProofDepth.Inc(int64(len(proof)))
+	metricsProofBytes.Inc(int64(size))
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+// StorageRootFunc decode the storage trie root from the value of an account,
+// e.g. the vars_hash of a serialized corepb.Account
+type StorageRootFunc func(account []byte) ([]byte, error)
+
+// ProveNested prove the storage key in the storage trie of the account in two levels, from the
+// root of the trie to the account, then from the storage root of the account to the storage key.
+// The storage trie is read from the storage of the trie, storageRoot decodes its root from the account.
+func (t *Trie) ProveNested(accountKey, storageKey []byte, storageRoot StorageRootFunc) (MerkleProof, MerkleProof, error) {
+	account, err := t.Get(accountKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	accountProof, err := t.Prove(accountKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := storageRoot(account)
+	if err != nil {
+		return nil, nil, err
+	}
+	storage, err := NewTrieWithSerializer(root, t.storage, false, t.serializer)
+	if err != nil {
+		return nil, nil, err
+	}
+	storageProof, err := storage.Prove(storageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return accountProof, storageProof, nil
+}
+
+// VerifyNested verify the two level proof of ProveNested against the root of the trie
+// and return the value of the storage key
+func (t *Trie) VerifyNested(rootHash, accountKey, storageKey []byte, accountProof, storageProof MerkleProof, storageRoot StorageRootFunc) ([]byte, error) {
+	if err := t.Verify(rootHash, accountKey, accountProof); err != nil {
+		return nil, err
+	}
+	// a verified proof ends with the leaf of the account
+	root, err := storageRoot(accountProof[len(accountProof)-1][2])
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Verify(root, storageKey, storageProof); err != nil {
+		return nil, err
+	}
+	return storageProof[len(storageProof)-1][2], nil
+}
@@ -0,0 +1,77 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+var errNotAccount = errors.New("not an account")
+
+// accountStorageRoot decode the test accounts, "acc:" followed by the storage root
+func accountStorageRoot(account []byte) ([]byte, error) {
+	if !bytes.HasPrefix(account, []byte("acc:")) {
+		return nil, errNotAccount
+	}
+	return account[4:], nil
+}
+
+func TestTrie_ProveNested(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	vars, _ := NewTrie(nil, stor, false)
+	vars.Put([]byte("slot1xx"), []byte("value1"))
+	vars.Put([]byte("slot2yy"), []byte("value2"))
+
+	state, _ := NewTrie(nil, stor, false)
+	state.Put([]byte("contract"), append([]byte("acc:"), vars.RootHash()...))
+	state.Put([]byte("otheracc"), []byte("acc:"))
+	state.Put([]byte("notacc01"), []byte("value"))
+	root := state.RootHash()
+
+	accountProof, storageProof, err := state.ProveNested([]byte("contract"), []byte("slot2yy"), accountStorageRoot)
+	assert.Nil(t, err)
+	val, err := state.VerifyNested(root, []byte("contract"), []byte("slot2yy"), accountProof, storageProof, accountStorageRoot)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), val)
+
+	// the levels can't be mixed up or proved against other keys
+	_, err = state.VerifyNested(root, []byte("contract"), []byte("slot1xx"), accountProof, storageProof, accountStorageRoot)
+	assert.NotNil(t, err)
+	_, err = state.VerifyNested(root, []byte("otheracc"), []byte("slot2yy"), accountProof, storageProof, accountStorageRoot)
+	assert.NotNil(t, err)
+	_, err = state.VerifyNested(vars.RootHash(), []byte("contract"), []byte("slot2yy"), accountProof, storageProof, accountStorageRoot)
+	assert.NotNil(t, err)
+	_, err = state.VerifyNested(root, []byte("contract"), []byte("slot2yy"), accountProof, accountProof, accountStorageRoot)
+	assert.Equal(t, ErrProofInvalid, err)
+
+	// missing storage keys, empty storage and values that aren't accounts
+	_, _, err = state.ProveNested([]byte("contract"), []byte("slot3zz"), accountStorageRoot)
+	assert.Equal(t, ErrNotFound, err)
+	_, _, err = state.ProveNested([]byte("otheracc"), []byte("slot1xx"), accountStorageRoot)
+	assert.Equal(t, ErrNotFound, err)
+	_, _, err = state.ProveNested([]byte("notacc01"), []byte("slot1xx"), accountStorageRoot)
+	assert.Equal(t, errNotAccount, err)
+	_, _, err = state.ProveNested([]byte("missing1"), []byte("slot1xx"), accountStorageRoot)
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"encoding/binary"
+	"hash"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// nodeHasher hash the nodes of a proof, reusing its buffers across the steps of the proof.
+// The digest returned by hash is only valid until the next call.
+type nodeHasher struct {
+	serializer Serializer
+	hasher     Hasher
+	state      hash.Hash
+	varint     [binary.MaxVarintLen64]byte
+	digest     []byte
+}
+
+func newNodeHasher(serializer Serializer, hasher Hasher) *nodeHasher {
+	h := &nodeHasher{serializer: serializer, hasher: hasher}
+	if hasher == nil {
+		h.state = sha3.New256()
+		h.digest = make([]byte, 0, h.state.Size())
+	}
+	return h
+}
+
+func (h *nodeHasher) hash(val [][]byte) ([]byte, error) {
+	_, isProto := h.serializer.(*ProtoSerializer)
+	if h.hasher == nil && isProto {
+		// stream the protobuf encoding of the node into the hash state
+		h.state.Reset()
+		for _, v := range val {
+			h.writeProtoField(v)
+		}
+		h.digest = h.state.Sum(h.digest[:0])
+		return h.digest, nil
+	}
+
+	ir, err := h.serializer.Serialize(val)
+	if err != nil {
+		return nil, err
+	}
+	if h.hasher != nil {
+		return h.hasher(ir), nil
+	}
+	h.state.Reset()
+	h.state.Write(ir)
+	h.digest = h.state.Sum(h.digest[:0])
+	return h.digest, nil
+}
+
+// writeProtoField write v as an element of the repeated bytes field 1 of triepb.Node
+func (h *nodeHasher) writeProtoField(v []byte) {
+	h.varint[0] = 1<<3 | 2
+	h.state.Write(h.varint[:1])
+	n := binary.PutUvarint(h.varint[:], uint64(len(v)))
+	h.state.Write(h.varint[:n])
+	h.state.Write(v)
+}
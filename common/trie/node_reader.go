@@ -0,0 +1,85 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"errors"
+)
+
+// Errors
+var (
+	ErrReadOnlyTrie = errors.New("trie is read only")
+)
+
+// NodeReader is the source of serialized trie nodes, keyed by node hash
+type NodeReader interface {
+	Get(hash []byte) ([]byte, error)
+}
+
+// readOnlyStorage adapt a NodeReader to storage.Storage, all writes fail
+type readOnlyStorage struct {
+	reader NodeReader
+}
+
+func (s *readOnlyStorage) Get(key []byte) ([]byte, error) {
+	return s.reader.Get(key)
+}
+
+func (s *readOnlyStorage) Put(key []byte, value []byte) error {
+	return ErrReadOnlyTrie
+}
+
+func (s *readOnlyStorage) Del(key []byte) error {
+	return ErrReadOnlyTrie
+}
+
+func (s *readOnlyStorage) EnableBatch() {}
+
+func (s *readOnlyStorage) DisableBatch() {}
+
+func (s *readOnlyStorage) Flush() error {
+	return nil
+}
+
+// NewProver create a read only trie on the nodes of reader, used to serve proofs
+// from a snapshot or a remote store. Modifying the trie returns ErrReadOnlyTrie.
+func NewProver(rootHash []byte, reader NodeReader) (*Trie, error) {
+	return NewTrie(rootHash, &readOnlyStorage{reader: reader}, false)
+}
+
+// NodeResolver adapt a function to NodeReader
+type NodeResolver func(hash []byte) ([]byte, error)
+
+// Get the serialized node of hash
+func (f NodeResolver) Get(hash []byte) ([]byte, error) {
+	return f(hash)
+}
+
+// ProveWithResolver prove the key against the current root of the trie,
+// fetching the nodes through resolve instead of the storage of the trie
+func (t *Trie) ProveWithResolver(key []byte, resolve func(hash []byte) ([]byte, error)) (MerkleProof, error) {
+	prover := &Trie{
+		rootHash:      t.rootHash,
+		storage:       &readOnlyStorage{reader: NodeResolver(resolve)},
+		maxProofDepth: t.maxProofDepth,
+		serializer:    t.serializer,
+	}
+	proof, _, err := prover.prove(key, 0)
+	return proof, err
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingReader struct {
+	stor  storage.Storage
+	reads int
+}
+
+func (r *countingReader) Get(hash []byte) ([]byte, error) {
+	r.reads++
+	return r.stor.Get(hash)
+}
+
+func TestNewProver(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+
+	reader := &countingReader{stor: stor}
+	prover, err := NewProver(tr.RootHash(), reader)
+	assert.Nil(t, err)
+
+	proof, err := prover.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.True(t, reader.reads > 0)
+	expected, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Equal(t, expected, proof)
+	assert.Nil(t, tr.Verify(tr.RootHash(), []byte("abbb"), proof))
+
+	value, err := prover.Get([]byte("aaaa"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+
+	_, err = prover.Put([]byte("abcc"), []byte("value3"))
+	assert.Equal(t, ErrReadOnlyTrie, err)
+
+	_, err = NewProver([]byte("missing"), reader)
+	assert.NotNil(t, err)
+}
+
+func TestTrie_ProveWithResolver(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+
+	// the nodes live in a remote store, the local trie only knows the root
+	local, _ := storage.NewMemoryStorage()
+	local.Put(tr.RootHash(), []byte{})
+	localTrie, err := NewTrie(tr.RootHash(), local, false)
+	assert.Nil(t, err)
+
+	reads := 0
+	resolve := func(hash []byte) ([]byte, error) {
+		reads++
+		return stor.Get(hash)
+	}
+	proof, err := localTrie.ProveWithResolver([]byte("abbb"), resolve)
+	assert.Nil(t, err)
+	assert.Equal(t, len(proof), reads)
+	assert.Nil(t, tr.Verify(tr.RootHash(), []byte("abbb"), proof))
+
+	_, err = localTrie.ProveWithResolver([]byte("zzzz"), resolve)
+	assert.Equal(t, ErrNotFound, err)
+	_, err = localTrie.Prove([]byte("abbb"))
+	assert.NotNil(t, err)
+}
@@ -21,28 +21,233 @@ package trie
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// Errors
+var (
+	ErrInvalidStateRoot   = errors.New("invalid state root, expect 32 bytes")
+	ErrProofValueMismatch = errors.New("value in proof mismatch")
+	ErrMalformedProof     = errors.New("malformed proof, contains empty node")
+	ErrProofTooDeep       = errors.New("proof is deeper than the max proof depth")
+	ErrInvalidProofDepth  = errors.New("proof depth must be positive")
+	ErrKeyPresent         = errors.New("proof shows the key is present")
+	ErrProofInvalid       = errors.New("proof nodes don't hash to the root")
+	ErrKeyNotProven       = errors.New("proof path doesn't reach the key")
+	ErrRootPruned         = errors.New("trie node not found in storage, the root may be pruned")
 )
 
 // MerkleProof is a path from root to the proved node
 // every element in path is the value of a node
 type MerkleProof [][][]byte
 
+// String pretty-print every node in the proof with its type and hash
+func (proof MerkleProof) String() string {
+	var buf bytes.Buffer
+	for i, val := range proof {
+		n := &node{Val: val}
+		if pb, err := n.ToProto(); err == nil {
+			if ir, err := proto.Marshal(pb); err == nil {
+				n.Hash = hash.Sha3256(ir)
+			}
+		}
+		flag, err := n.Type()
+		if err != nil {
+			buf.WriteString(fmt.Sprintf("%d: invalid node, %s\n", i, err))
+			continue
+		}
+		switch flag {
+		case branch:
+			buf.WriteString(fmt.Sprintf("%d: branch %s\n", i, byteutils.Hex(n.Hash)))
+			for idx, child := range val {
+				if len(child) > 0 {
+					buf.WriteString(fmt.Sprintf("\t[%x] %s\n", idx, byteutils.Hex(child)))
+				}
+			}
+		case ext:
+			buf.WriteString(fmt.Sprintf("%d: ext %s\n\tpath %s\n\tnext %s\n", i, byteutils.Hex(n.Hash), byteutils.Hex(val[1]), byteutils.Hex(val[2])))
+		case leaf:
+			buf.WriteString(fmt.Sprintf("%d: leaf %s\n\tpath %s\n\tvalue %s\n", i, byteutils.Hex(n.Hash), byteutils.Hex(val[1]), byteutils.Hex(val[2])))
+		default:
+			buf.WriteString(fmt.Sprintf("%d: unknown node %s\n", i, byteutils.Hex(n.Hash)))
+		}
+	}
+	return buf.String()
+}
+
+// SetMaxProofDepth set the max number of nodes Prove walks through before
+// aborting with ErrProofTooDeep, guards against loops in corrupted storage.
+// depth <= 0 means the default, which is one more than the key's route length
+func (t *Trie) SetMaxProofDepth(depth int) {
+	t.maxProofDepth = depth
+}
+
+func (t *Trie) proofDepthLimit(route []byte) int {
+	if t.maxProofDepth > 0 {
+		return t.maxProofDepth
+	}
+	return len(route) + 1
+}
+
 // Prove the associated node to the key exists in trie
 // if exists, MerkleProof is a complete path from root to the node
 // otherwise, MerkleProof is nil
 func (t *Trie) Prove(key []byte) (MerkleProof, error) {
+	if proof, ok := t.getCachedProof(key); ok {
+		t.recordProof(proof)
+		return proof, nil
+	}
+	proof, _, err := t.prove(key, 0)
+	if err != nil {
+		return nil, err
+	}
+	t.cacheProof(key, proof)
+	t.recordProof(proof)
+	return proof, nil
+}
+
+// ProveWithSiblings return the merkle proof of the key and the sibling hashes of every level.
+// For a branch node, the siblings are the branchWidth-1 child hashes other than the descended one,
+// in ascending slot order, with empty slots as empty hashes. Ext and leaf nodes have no siblings.
+func (t *Trie) ProveWithSiblings(key []byte) (MerkleProof, [][][]byte, error) {
+	proof, err := t.Prove(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	curRoute := keyToRoute(key)
+	siblings := make([][][]byte, len(proof))
+	for i, val := range proof {
+		switch len(val) {
+		case branchWidth:
+			level := make([][]byte, 0, branchWidth-1)
+			for slot, child := range val {
+				if slot != int(curRoute[0]) {
+					level = append(level, child)
+				}
+			}
+			siblings[i] = level
+			curRoute = curRoute[1:]
+		default:
+			curRoute = curRoute[len(val[1]):]
+		}
+	}
+	return proof, siblings, nil
+}
+
+// ProveWithHashes return the merkle proof of the key and the hash of every node in the proof,
+// levelHashes[0] is the root hash and levelHashes[i] is the hash of proof[i]. Clients can cache
+// the hashes to skip verifying the prefix shared with the proof of a nearby key.
+func (t *Trie) ProveWithHashes(key []byte) (MerkleProof, [][]byte, error) {
+	proof, err := t.Prove(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	curRoute := keyToRoute(key)
+	levelHashes := make([][]byte, len(proof))
+	h := t.rootHash
+	for i, val := range proof {
+		levelHashes[i] = h
+		switch len(val) {
+		case branchWidth:
+			h = val[curRoute[0]]
+			curRoute = curRoute[1:]
+		default:
+			h = val[2]
+			curRoute = curRoute[len(val[1]):]
+		}
+	}
+	return proof, levelHashes, nil
+}
+
+// ProofLength return the number of nodes in the proof of the key without building the proof,
+// ErrNotFound is returned if the key doesn't exist as Prove does
+func (t *Trie) ProofLength(key []byte) (int, error) {
+	if t.Empty() {
+		return 0, ErrNotFound
+	}
 	curRoute := keyToRoute(key)
 	curRootHash := t.rootHash
+	maxDepth := t.proofDepthLimit(curRoute)
+	length := 0
+	for len(curRoute) > 0 {
+		if length >= maxDepth {
+			return 0, ErrProofTooDeep
+		}
+		rootNode, err := t.fetchNode(curRootHash)
+		if err != nil {
+			return 0, err
+		}
+		flag, err := rootNode.Type()
+		if err != nil {
+			return 0, err
+		}
+		length++
+		switch flag {
+		case branch:
+			curRootHash = rootNode.Val[curRoute[0]]
+			curRoute = curRoute[1:]
+		case ext:
+			path := rootNode.Val[1]
+			if prefixLen(path, curRoute) != len(path) {
+				return 0, ErrNotFound
+			}
+			curRootHash = rootNode.Val[2]
+			curRoute = curRoute[len(path):]
+		case leaf:
+			// the leaf of a shorter key doesn't prove a key extending it
+			path := rootNode.Val[1]
+			matchLen := prefixLen(path, curRoute)
+			if matchLen != len(path) || matchLen != len(curRoute) {
+				return 0, ErrNotFound
+			}
+			return length, nil
+		default:
+			return 0, ErrNotFound
+		}
+	}
+	return 0, ErrNotFound
+}
+
+// ProveToDepth return the merkle proof of the key down to at most depth nodes,
+// and the hash of the node where the proof stops, which the verifier trusts for the remainder.
+// if the leaf is reached within depth, the complete proof and nil hash are returned
+func (t *Trie) ProveToDepth(key []byte, depth int) (MerkleProof, []byte, error) {
+	if depth <= 0 {
+		return nil, nil, ErrInvalidProofDepth
+	}
+	return t.prove(key, depth)
+}
+
+// prove the key, stop at depth nodes if depth > 0
+func (t *Trie) prove(key []byte, depth int) (MerkleProof, []byte, error) {
+	if t.Empty() {
+		return nil, nil, ErrNotFound
+	}
+	curRoute := keyToRoute(key)
+	curRootHash := t.rootHash
+	maxDepth := t.proofDepthLimit(curRoute)
 	var proof MerkleProof
 	for len(curRoute) > 0 {
+		if depth > 0 && len(proof) == depth {
+			return proof, curRootHash, nil
+		}
+		if len(proof) >= maxDepth {
+			return nil, nil, ErrProofTooDeep
+		}
 		// fetch sub-trie root node
 		rootNode, err := t.fetchNode(curRootHash)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		flag, err := rootNode.Type()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		switch flag {
 		case branch:
@@ -54,68 +259,342 @@ func (t *Trie) Prove(key []byte) (MerkleProof, error) {
 			next := rootNode.Val[2]
 			matchLen := prefixLen(path, curRoute)
 			if matchLen != len(path) {
-				return nil, ErrNotFound
+				return nil, nil, ErrNotFound
 			}
 			proof = append(proof, rootNode.Val)
 			curRootHash = next
 			curRoute = curRoute[matchLen:]
 		case leaf:
+			// the leaf of a shorter key doesn't prove a key extending it
 			path := rootNode.Val[1]
 			matchLen := prefixLen(path, curRoute)
-			if matchLen != len(path) {
-				return nil, ErrNotFound
+			if matchLen != len(path) || matchLen != len(curRoute) {
+				return nil, nil, ErrNotFound
 			}
 			proof = append(proof, rootNode.Val)
-			return proof, nil
+			return proof, nil, nil
 		default:
-			return nil, ErrNotFound
+			return nil, nil, ErrNotFound
 		}
 	}
-	return nil, ErrNotFound
+	return nil, nil, ErrNotFound
 }
 
 // Verify whether the merkle proof from root to the associated node is right
 func (t *Trie) Verify(rootHash []byte, key []byte, proof MerkleProof) error {
+	return t.verify(rootHash, key, proof, false)
+}
+
+// VerifyFromTrustedRoot verify the merkle proof assuming proof[0] is the root node,
+// only the hash links from proof[0] down to the leaf are checked.
+// Use it only when proof[0] was obtained over an authenticated channel.
+func (t *Trie) VerifyFromTrustedRoot(key []byte, proof MerkleProof) error {
+	return t.verify(nil, key, proof, true)
+}
+
+// VerifyFromRootNode verify the merkle proof against the serialized root node, whose hash is
+// the root hash, and return the value of the key. The proof may start at the root node or
+// leave it out and start at its child. Otherwise it's the same as Verify.
+func (t *Trie) VerifyFromRootNode(rootNodeIR []byte, key []byte, proof MerkleProof) ([]byte, error) {
+	if len(rootNodeIR) == 0 {
+		return nil, ErrMalformedProof
+	}
+	rootHash := hash.Sha3256(rootNodeIR)
+
+	startsAtRoot := false
+	if len(proof) > 0 && len(proof[0]) > 0 {
+		h, err := newNodeHasher(t.serializer, nil).hash(proof[0])
+		startsAtRoot = err == nil && bytes.Equal(h, rootHash)
+	}
+	if !startsAtRoot {
+		val, err := t.serializer.Deserialize(rootNodeIR)
+		if err != nil {
+			return nil, err
+		}
+		proof = append(MerkleProof{val}, proof...)
+	}
+
+	if err := t.verify(rootHash, key, proof, false); err != nil {
+		return nil, err
+	}
+	return proof[len(proof)-1][2], nil
+}
+
+func (t *Trie) verify(rootHash []byte, key []byte, proof MerkleProof, trustedRoot bool) error {
+	// no key is included in an empty trie
+	if !trustedRoot && IsEmptyRoot(rootHash) {
+		return ErrKeyNotProven
+	}
 	curRoute := keyToRoute(key)
 	length := len(proof)
 	wantHash := rootHash
+	hasher := newNodeHasher(t.serializer, nil)
 	for i := 0; i < length; i++ {
 		val := proof[i]
-		n, err := t.createNode(val)
-		if err != nil {
-			return err
+		if len(val) == 0 {
+			return ErrMalformedProof
 		}
-		proofHash := n.Hash
-		if !bytes.Equal(wantHash, proofHash) {
-			return errors.New("wrong hash")
+		// the first element must hash to the root, every other one to the hash
+		// its previous element links to, so elements can't be reordered or inserted
+		if i > 0 || !trustedRoot {
+			proofHash, err := hasher.hash(val)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(wantHash, proofHash) {
+				return ErrProofInvalid
+			}
 		}
 		switch len(val) {
-		case 16: // Branch Node
+		case branchWidth: // Branch Node
+			if len(curRoute) == 0 || int(curRoute[0]) >= branchWidth {
+				return ErrMalformedProof
+			}
 			wantHash = val[curRoute[0]]
 			curRoute = curRoute[1:]
 			break
 		case 3: // Extension Node or Leaf Node
-			if val[0] == nil || len(val) == 0 {
-				return errors.New("unknown node type")
+			if len(val[0]) == 0 {
+				return ErrProofInvalid
 			}
 			if val[0][0] == byte(ext) {
 				extLen := len(val[1])
+				if extLen > len(curRoute) {
+					return ErrMalformedProof
+				}
 				if !bytes.Equal(val[1], curRoute[:extLen]) {
-					return errors.New("wrong hash")
+					return ErrKeyNotProven
 				}
 				wantHash = val[2]
 				curRoute = curRoute[extLen:]
 				break
 			} else if val[0][0] == byte(leaf) {
 				if !bytes.Equal(val[1], curRoute) {
-					return errors.New("wrong hash")
+					return ErrKeyNotProven
+				}
+				// no element can follow the leaf, nothing links to it
+				if i != length-1 {
+					return ErrProofInvalid
 				}
 				return nil
 			}
-			return errors.New("unknown node type")
+			return ErrProofInvalid
 		default:
-			return errors.New("wrong node value, expect [16][]byte or [3][]byte, get [" + string(len(proofHash)) + "][]byte")
+			return ErrProofInvalid
 		}
 	}
+	// the proof stops before reaching the leaf of the key
+	return ErrKeyNotProven
+}
+
+// VerifyStateProof verify the key-value pair against the state root in a block header,
+// blockStateRoot must be a complete Sha3256 hash, truncated roots are rejected up front
+func (t *Trie) VerifyStateProof(blockStateRoot []byte, key []byte, value []byte, proof MerkleProof) error {
+	if len(blockStateRoot) != 32 {
+		return ErrInvalidStateRoot
+	}
+	if err := t.Verify(blockStateRoot, key, proof); err != nil {
+		return err
+	}
+	val := proof[len(proof)-1]
+	if len(val) != 3 || len(val[0]) == 0 || val[0][0] != byte(leaf) {
+		return ErrNotFound
+	}
+	if !bytes.Equal(val[2], value) {
+		return ErrProofValueMismatch
+	}
 	return nil
 }
+
+// proveInclusionOrExclusion return the path from rootHash towards the key,
+// if the key doesn't exist, the path stops at the node where the route diverges
+func (t *Trie) proveInclusionOrExclusion(rootHash []byte, key []byte) (MerkleProof, bool, error) {
+	curRoute := keyToRoute(key)
+	curRootHash := rootHash
+	maxDepth := t.proofDepthLimit(curRoute)
+	var proof MerkleProof
+	for len(curRootHash) > 0 {
+		if len(proof) >= maxDepth {
+			return nil, false, ErrProofTooDeep
+		}
+		rootNode, err := t.fetchNode(curRootHash)
+		if err != nil {
+			return nil, false, err
+		}
+		flag, err := rootNode.Type()
+		if err != nil {
+			return nil, false, err
+		}
+		proof = append(proof, rootNode.Val)
+		switch flag {
+		case branch:
+			if len(curRoute) == 0 {
+				return proof, false, nil
+			}
+			curRootHash = rootNode.Val[curRoute[0]]
+			curRoute = curRoute[1:]
+		case ext:
+			path := rootNode.Val[1]
+			if prefixLen(path, curRoute) != len(path) {
+				return proof, false, nil
+			}
+			curRootHash = rootNode.Val[2]
+			curRoute = curRoute[len(path):]
+		case leaf:
+			return proof, bytes.Equal(rootNode.Val[1], curRoute), nil
+		default:
+			return nil, false, errors.New("unknown node type")
+		}
+	}
+	return proof, false, nil
+}
+
+// HistoryError collects the errors of the roots failed in ProveHistory, keyed by root index
+type HistoryError map[int]error
+
+func (e HistoryError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString("failed to prove history at ")
+	buf.WriteString(strconv.Itoa(len(e)))
+	buf.WriteString(" roots")
+	indexes := make([]int, 0, len(e))
+	for i := range e {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		buf.WriteString(fmt.Sprintf(", root %d: %s", i, e[i]))
+	}
+	return buf.String()
+}
+
+// ProveHistory return a proof and the value of the key at each root,
+// the value is nil and the proof is an exclusion proof where the key is absent.
+// Roots which can't be proved, e.g. pruned from storage, are reported in a HistoryError
+// with nil proof, the other roots are still proved.
+func (t *Trie) ProveHistory(key []byte, roots [][]byte) ([]MerkleProof, [][]byte, error) {
+	proofs := make([]MerkleProof, len(roots))
+	values := make([][]byte, len(roots))
+	errs := make(HistoryError)
+	for i, root := range roots {
+		proof, found, err := t.proveInclusionOrExclusion(root, key)
+		if err == ErrNotFound {
+			err = ErrRootPruned
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		proofs[i] = proof
+		if found {
+			values[i] = proof[len(proof)-1][2]
+		}
+	}
+	if len(errs) > 0 {
+		return proofs, values, errs
+	}
+	return proofs, values, nil
+}
+
+// ProveWithPresence return an inclusion proof if the key exists in trie,
+// otherwise an exclusion proof ending at the node where the route diverges
+func (t *Trie) ProveWithPresence(key []byte) (MerkleProof, bool, error) {
+	return t.proveInclusionOrExclusion(t.rootHash, key)
+}
+
+// VerifyProof verify the inclusion or exclusion proof of the key against rootHash,
+// present tells whether the key exists, so that an empty value is distinct from an absent key
+func (t *Trie) VerifyProof(rootHash []byte, key []byte, proof MerkleProof) ([]byte, bool, error) {
+	return verifyProof(rootHash, key, proof, newNodeHasher(t.serializer, nil))
+}
+
+// Hasher compute the hash of a serialized node
+type Hasher func(args ...[]byte) []byte
+
+// VerifyAbsence verify the exclusion proof of key against root without a trie instance,
+// the proof must be consistent from the root down to the node where the route diverges.
+// nil serializer or hasher default to ProtoSerializer and sha3-256.
+func VerifyAbsence(root, key []byte, proof MerkleProof, serializer Serializer, hasher Hasher) error {
+	if serializer == nil {
+		serializer = &ProtoSerializer{}
+	}
+	_, present, err := verifyProof(root, key, proof, newNodeHasher(serializer, hasher))
+	if err != nil {
+		return err
+	}
+	if present {
+		return ErrKeyPresent
+	}
+	return nil
+}
+
+func verifyProof(rootHash []byte, key []byte, proof MerkleProof, hasher *nodeHasher) ([]byte, bool, error) {
+	if IsEmptyRoot(rootHash) {
+		if len(proof) != 0 {
+			return nil, false, ErrMalformedProof
+		}
+		return nil, false, nil
+	}
+
+	curRoute := keyToRoute(key)
+	wantHash := rootHash
+	for i, val := range proof {
+		if len(val) == 0 {
+			return nil, false, ErrMalformedProof
+		}
+		proofHash, err := hasher.hash(val)
+		if err != nil {
+			return nil, false, err
+		}
+		if !bytes.Equal(wantHash, proofHash) {
+			return nil, false, ErrProofInvalid
+		}
+		last := i == len(proof)-1
+
+		n := &node{Val: val}
+		flag, err := n.Type()
+		if err != nil {
+			return nil, false, err
+		}
+		switch flag {
+		case branch:
+			if len(curRoute) == 0 {
+				// the key is a prefix of the keys below, branch nodes hold no value
+				if !last {
+					return nil, false, ErrMalformedProof
+				}
+				return nil, false, nil
+			}
+			wantHash = val[curRoute[0]]
+			curRoute = curRoute[1:]
+			if len(wantHash) == 0 {
+				if !last {
+					return nil, false, ErrMalformedProof
+				}
+				return nil, false, nil
+			}
+		case ext:
+			path := val[1]
+			if prefixLen(path, curRoute) != len(path) {
+				if !last {
+					return nil, false, ErrMalformedProof
+				}
+				return nil, false, nil
+			}
+			wantHash = val[2]
+			curRoute = curRoute[len(path):]
+		case leaf:
+			if !last {
+				return nil, false, ErrMalformedProof
+			}
+			if !bytes.Equal(val[1], curRoute) {
+				return nil, false, nil
+			}
+			return val[2], true, nil
+		default:
+			return nil, false, ErrProofInvalid
+		}
+	}
+	// the proof stops before reaching a leaf or a diverging node
+	return nil, false, ErrMalformedProof
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+type proofCacheKey struct {
+	root string
+	key  string
+}
+
+// EnableProofCache let Prove consult a LRU cache of proofs keyed by (root, key),
+// cached proofs of outdated roots are dropped when the root changes
+func (t *Trie) EnableProofCache(size int) error {
+	cache, err := lru.New(size)
+	if err != nil {
+		return err
+	}
+	t.muProofCache.Lock()
+	t.proofCache = cache
+	t.proofCacheRoot = t.rootHash
+	t.muProofCache.Unlock()
+	atomic.StoreUint64(&t.counters.cacheHits, 0)
+	atomic.StoreUint64(&t.counters.cacheMisses, 0)
+	return nil
+}
+
+// ProofCacheStats return the hit and miss counts of the proof cache
+func (t *Trie) ProofCacheStats() (uint64, uint64) {
+	return atomic.LoadUint64(&t.counters.cacheHits), atomic.LoadUint64(&t.counters.cacheMisses)
+}
+
+func (t *Trie) getCachedProof(key []byte) (MerkleProof, bool) {
+	if t.proofCache == nil {
+		return nil, false
+	}
+	// concurrent provers may all see the new root, only one of them purges
+	t.muProofCache.Lock()
+	if !bytes.Equal(t.proofCacheRoot, t.rootHash) {
+		t.proofCache.Purge()
+		t.proofCacheRoot = t.rootHash
+	}
+	t.muProofCache.Unlock()
+	v, ok := t.proofCache.Get(proofCacheKey{string(t.rootHash), string(key)})
+	if !ok {
+		atomic.AddUint64(&t.counters.cacheMisses, 1)
+		metricsProofCacheMiss.Inc(1)
+		return nil, false
+	}
+	atomic.AddUint64(&t.counters.cacheHits, 1)
+	metricsProofCacheHit.Inc(1)
+	return copyProof(v.(MerkleProof)), true
+}
+
+func (t *Trie) cacheProof(key []byte, proof MerkleProof) {
+	if t.proofCache == nil {
+		return
+	}
+	t.proofCache.Add(proofCacheKey{string(t.rootHash), string(key)}, copyProof(proof))
+}
+
+func copyProof(proof MerkleProof) MerkleProof {
+	cp := make(MerkleProof, len(proof))
+	for i, val := range proof {
+		cp[i] = make([][]byte, len(val))
+		for j, v := range val {
+			if v != nil {
+				cp[i][j] = append([]byte{}, v...)
+			}
+		}
+	}
+	return cp
+}
@@ -0,0 +1,137 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nebulasio/go-nebulas/common/trie/pb"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// Errors
+var (
+	ErrInconsistentProofs = errors.New("proofs contain different nodes at the same position")
+	ErrProofsFailed       = errors.New("some proofs in the set failed verification")
+)
+
+// ProofSet is a set of single-key proofs sharing the same root
+type ProofSet struct {
+	trie   *Trie
+	keys   [][]byte
+	proofs []MerkleProof
+}
+
+// NewProofSet create an empty proof set verified by the trie
+func (t *Trie) NewProofSet() *ProofSet {
+	return &ProofSet{trie: t}
+}
+
+// ProveMany prove all the keys against the current root of the trie
+func (t *Trie) ProveMany(keys [][]byte) (*ProofSet, error) {
+	set := t.NewProofSet()
+	for _, key := range keys {
+		proof, err := t.Prove(key)
+		if err != nil {
+			return nil, err
+		}
+		set.Add(key, proof)
+	}
+	return set, nil
+}
+
+// Add the proof of the key into the set
+func (set *ProofSet) Add(key []byte, proof MerkleProof) {
+	set.keys = append(set.keys, key)
+	set.proofs = append(set.proofs, proof)
+}
+
+// Len return the number of proofs in the set
+func (set *ProofSet) Len() int {
+	return len(set.proofs)
+}
+
+// Verify all the proofs against root, and check the proofs are consistent with each other,
+// nodes at the same position of the trie must be identical across proofs
+func (set *ProofSet) Verify(root []byte) error {
+	if err := set.checkConsistency(); err != nil {
+		return err
+	}
+	for i, proof := range set.proofs {
+		if err := set.trie.Verify(root, set.keys[i], proof); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyEach verify every proof against root, the result is keyed by the hex key
+// and holds nil for the keys verified. The overall error is ErrInconsistentProofs
+// if the proofs contradict each other, ErrProofsFailed if any key failed.
+func (set *ProofSet) VerifyEach(root []byte) (map[string]error, error) {
+	results := make(map[string]error, len(set.proofs))
+	failed := false
+	for i, proof := range set.proofs {
+		err := set.trie.Verify(root, set.keys[i], proof)
+		results[byteutils.Hex(set.keys[i])] = err
+		if err != nil {
+			failed = true
+		}
+	}
+	if err := set.checkConsistency(); err != nil {
+		return results, err
+	}
+	if failed {
+		return results, ErrProofsFailed
+	}
+	return results, nil
+}
+
+// checkConsistency check nodes at the same position, identified by the consumed route, are identical
+func (set *ProofSet) checkConsistency() error {
+	nodes := make(map[string][]byte)
+	for i, proof := range set.proofs {
+		route := keyToRoute(set.keys[i])
+		consumed := 0
+		for _, val := range proof {
+			if consumed > len(route) {
+				break
+			}
+			ir, err := proto.Marshal(&triepb.Node{Val: val})
+			if err != nil {
+				return err
+			}
+			position := string(route[:consumed])
+			if existed, ok := nodes[position]; ok && !bytes.Equal(existed, ir) {
+				return ErrInconsistentProofs
+			}
+			nodes[position] = ir
+
+			switch len(val) {
+			case branchWidth:
+				consumed++
+			case 3:
+				consumed += len(val[1])
+			}
+		}
+	}
+	return nil
+}
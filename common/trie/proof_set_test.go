@@ -0,0 +1,92 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_ProveMany(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abcc")}
+	for _, key := range keys {
+		tr.Put(key, key)
+	}
+
+	set, err := tr.ProveMany(keys)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, set.Len())
+	assert.Nil(t, set.Verify(tr.RootHash()))
+	assert.NotNil(t, set.Verify([]byte("wrong root")))
+
+	_, err = tr.ProveMany([][]byte{[]byte("zzzz")})
+	assert.NotNil(t, err)
+
+	// a proof against another root contradicts the ancestors of the others
+	oldRoot := tr.RootHash()
+	tr.Put([]byte("abcc"), []byte("updated"))
+	proof, err := tr.Prove([]byte("abcc"))
+	assert.Nil(t, err)
+
+	tr2, _ := NewTrie(oldRoot, stor, false)
+	set, _ = tr2.ProveMany(keys[:2])
+	set.Add([]byte("abcc"), proof)
+	assert.Equal(t, ErrInconsistentProofs, set.Verify(oldRoot))
+}
+
+func TestProofSet_VerifyEach(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abcc")}
+	for _, key := range keys {
+		tr.Put(key, key)
+	}
+
+	set, err := tr.ProveMany(keys)
+	assert.Nil(t, err)
+	results, err := set.VerifyEach(tr.RootHash())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	for _, key := range keys {
+		assert.Nil(t, results[byteutils.Hex(key)])
+	}
+
+	// a tampered proof only fails its own key
+	set = tr.NewProofSet()
+	for i, key := range keys {
+		proof, err := tr.Prove(key)
+		assert.Nil(t, err)
+		if i == 1 {
+			leaf := proof[len(proof)-1]
+			proof = append(MerkleProof{}, proof[:len(proof)-1]...)
+			proof = append(proof, [][]byte{leaf[0], leaf[1], []byte("tampered")})
+		}
+		set.Add(key, proof)
+	}
+	results, err = set.VerifyEach(tr.RootHash())
+	assert.Equal(t, ErrProofsFailed, err)
+	assert.Nil(t, results[byteutils.Hex(keys[0])])
+	assert.NotNil(t, results[byteutils.Hex(keys[1])])
+	assert.Nil(t, results[byteutils.Hex(keys[2])])
+}
@@ -0,0 +1,823 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nebulasio/go-nebulas/common/trie/pb"
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_VerifyFromTrustedRoot(t *testing.T) {
+	storage, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, storage, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("accc"), []byte("value3"))
+
+	proof, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Nil(t, tr.Verify(tr.RootHash(), []byte("abbb"), proof))
+	assert.Nil(t, tr.VerifyFromTrustedRoot([]byte("abbb"), proof))
+
+	// a wrong root is only detected by the full check
+	assert.NotNil(t, tr.Verify([]byte("wrong root"), []byte("abbb"), proof))
+	assert.Nil(t, tr.VerifyFromTrustedRoot([]byte("abbb"), proof))
+
+	// broken links below the root are still detected
+	proof[len(proof)-1][2] = []byte("tampered")
+	assert.NotNil(t, tr.VerifyFromTrustedRoot([]byte("abbb"), proof))
+}
+
+func TestTrie_VerifyStateProof(t *testing.T) {
+	storage, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, storage, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+
+	proof, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Nil(t, tr.VerifyStateProof(tr.RootHash(), []byte("abbb"), []byte("value2"), proof))
+	assert.Equal(t, ErrProofValueMismatch, tr.VerifyStateProof(tr.RootHash(), []byte("abbb"), []byte("value1"), proof))
+	assert.Equal(t, ErrInvalidStateRoot, tr.VerifyStateProof(tr.RootHash()[:31], []byte("abbb"), []byte("value2"), proof))
+	assert.Equal(t, ErrInvalidStateRoot, tr.VerifyStateProof(nil, []byte("abbb"), []byte("value2"), proof))
+	assert.NotNil(t, tr.VerifyStateProof(tr.RootHash(), []byte("abbb"), []byte("value2"), nil))
+}
+
+func TestTrie_VerifyMalformedProof(t *testing.T) {
+	storage, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, storage, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+
+	proof, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.True(t, len(proof) >= 3)
+
+	for _, empty := range [][][]byte{nil, [][]byte{}} {
+		for _, pos := range []int{0, len(proof) / 2, len(proof) - 1} {
+			malformed := append(MerkleProof{}, proof...)
+			malformed[pos] = empty
+			assert.Equal(t, ErrMalformedProof, tr.Verify(tr.RootHash(), []byte("abbb"), malformed))
+			assert.Equal(t, ErrMalformedProof, tr.VerifyFromTrustedRoot([]byte("abbb"), malformed))
+		}
+	}
+}
+
+func TestTrie_ProveMaxDepth(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+
+	proof, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+
+	tr.SetMaxProofDepth(len(proof) - 1)
+	_, err = tr.Prove([]byte("abbb"))
+	assert.Equal(t, ErrProofTooDeep, err)
+	tr.SetMaxProofDepth(len(proof))
+	_, err = tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+
+	// an ext node pointing back to itself in corrupted storage
+	corrupted := []byte("corrupted node hash")
+	ir, _ := proto.Marshal(&triepb.Node{Val: [][]byte{[]byte{byte(ext)}, []byte{}, corrupted}})
+	stor.Put(corrupted, ir)
+	tr, err = NewTrie(corrupted, stor, false)
+	assert.Nil(t, err)
+	_, err = tr.Prove([]byte("abbb"))
+	assert.Equal(t, ErrProofTooDeep, err)
+}
+
+func TestMerkleProof_String(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+
+	proof, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	s := proof.String()
+	assert.Contains(t, s, "0: ext "+byteutils.Hex(tr.RootHash()))
+	assert.Contains(t, s, "branch")
+	assert.Contains(t, s, "leaf")
+	assert.Contains(t, s, "value "+byteutils.Hex([]byte("value2")))
+
+	proof = append(proof, [][]byte{[]byte{}, nil, nil})
+	assert.Contains(t, proof.String(), "invalid node")
+}
+
+func TestTrie_ProofCache(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	assert.Nil(t, tr.EnableProofCache(16))
+
+	proof1, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	proof2, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Equal(t, proof1, proof2)
+	hits, misses := tr.ProofCacheStats()
+	assert.Equal(t, uint64(1), hits)
+	assert.Equal(t, uint64(1), misses)
+
+	// cached proofs can't be mutated by callers
+	proof2[0][0] = []byte("mutated")
+	proof3, _ := tr.Prove([]byte("abbb"))
+	assert.Equal(t, proof1, proof3)
+
+	// proofs of the old root are dropped
+	tr.Put([]byte("abcc"), []byte("value3"))
+	proof4, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Nil(t, tr.Verify(tr.RootHash(), []byte("abbb"), proof4))
+	hits, misses = tr.ProofCacheStats()
+	assert.Equal(t, uint64(2), hits)
+	assert.Equal(t, uint64(2), misses)
+}
+
+func benchmarkProveSkewed(b *testing.B, cacheSize int) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys := make([][]byte, 10000)
+	for i := range keys {
+		keys[i] = hash.Sha3256(byteutils.FromInt64(int64(i)))
+		tr.Put(keys[i], keys[i])
+	}
+	if cacheSize > 0 {
+		tr.EnableProofCache(cacheSize)
+	}
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.2, 1, uint64(len(keys)-1))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Prove(keys[zipf.Uint64()])
+	}
+	if cacheSize > 0 {
+		hits, misses := tr.ProofCacheStats()
+		b.Logf("proof cache hit rate %.2f", float64(hits)/float64(hits+misses))
+	}
+}
+
+func BenchmarkTrie_Prove(b *testing.B) {
+	benchmarkProveSkewed(b, 0)
+}
+
+func BenchmarkTrie_ProveWithCache(b *testing.B) {
+	benchmarkProveSkewed(b, 1024)
+}
+
+func TestTrie_ProveToDepth(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+
+	full, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+
+	for depth := 1; depth < len(full); depth++ {
+		proof, reached, err := tr.ProveToDepth([]byte("abbb"), depth)
+		assert.Nil(t, err)
+		assert.Equal(t, full[:depth], proof)
+		ir, _ := proto.Marshal(&triepb.Node{Val: full[depth]})
+		assert.Equal(t, hash.Sha3256(ir), reached)
+	}
+
+	proof, reached, err := tr.ProveToDepth([]byte("abbb"), len(full)+1)
+	assert.Nil(t, err)
+	assert.Nil(t, reached)
+	assert.Equal(t, full, proof)
+
+	_, _, err = tr.ProveToDepth([]byte("abbb"), 0)
+	assert.Equal(t, ErrInvalidProofDepth, err)
+}
+
+func TestTrie_VerifyBranchWidth(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+
+	proof, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Equal(t, branchWidth, len(proof[1]))
+
+	// a branch node with a value slot is not a valid node
+	wide := append(MerkleProof{}, proof...)
+	wide[1] = append(append([][]byte{}, proof[1]...), []byte("value"))
+	assert.NotNil(t, tr.VerifyFromTrustedRoot([]byte("abbb"), wide))
+
+	// a branch node can't be the end of the route
+	short := MerkleProof{proof[1]}
+	assert.Equal(t, ErrMalformedProof, tr.VerifyFromTrustedRoot([]byte{}, short))
+}
+
+func TestTrie_ProveHistory(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	roots := [][]byte{}
+
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	roots = append(roots, tr.RootHash())
+	tr.Put([]byte("abbb"), []byte("value2"))
+	roots = append(roots, tr.RootHash())
+	tr.Put([]byte("abbb"), []byte("value3"))
+	roots = append(roots, tr.RootHash())
+	tr.Del([]byte("abbb"))
+	roots = append(roots, tr.RootHash())
+	roots = append(roots, hash.Sha3256([]byte("pruned")))
+
+	proofs, values, err := tr.ProveHistory([]byte("abbb"), roots)
+	herr, ok := err.(HistoryError)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(herr))
+	assert.Equal(t, ErrRootPruned, herr[4])
+	assert.Nil(t, proofs[4])
+
+	assert.Equal(t, [][]byte{nil, []byte("value2"), []byte("value3"), nil, nil}, values)
+	assert.Nil(t, tr.VerifyStateProof(roots[1], []byte("abbb"), []byte("value2"), proofs[1]))
+	assert.Nil(t, tr.VerifyStateProof(roots[2], []byte("abbb"), []byte("value3"), proofs[2]))
+
+	// exclusion proofs stop at the diverging leaf
+	assert.Equal(t, 1, len(proofs[0]))
+	assert.Equal(t, 1, len(proofs[3]))
+	assert.Equal(t, []byte("value1"), proofs[3][0][2])
+
+	_, _, err = tr.ProveHistory([]byte("abbb"), roots[:4])
+	assert.Nil(t, err)
+}
+
+func TestTrie_VerifyProofPresence(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+
+	value, present, err := tr.VerifyProof(tr.RootHash(), []byte("aaaa"), nil)
+	assert.Nil(t, err)
+	assert.False(t, present)
+	assert.Nil(t, value)
+
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte{})
+	tr.Put([]byte("abcc"), []byte("value3"))
+
+	cases := []struct {
+		key     []byte
+		value   []byte
+		present bool
+	}{
+		{[]byte("aaaa"), []byte("value1"), true},
+		{[]byte("abbb"), []byte{}, true},
+		{[]byte("abcd"), nil, false},
+		{[]byte("abdd"), nil, false},
+		{[]byte("bbbb"), nil, false},
+	}
+	for _, c := range cases {
+		proof, present, err := tr.ProveWithPresence(c.key)
+		assert.Nil(t, err)
+		assert.Equal(t, c.present, present)
+
+		value, present, err := tr.VerifyProof(tr.RootHash(), c.key, proof)
+		assert.Nil(t, err)
+		assert.Equal(t, c.present, present)
+		assert.Equal(t, string(c.value), string(value))
+
+		_, _, err = tr.VerifyProof(tr.RootHash(), c.key, proof[:len(proof)-1])
+		assert.NotNil(t, err)
+		_, _, err = tr.VerifyProof([]byte("wrong root"), c.key, proof)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestVerifyAbsence(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrieWithSerializer(nil, stor, false, &JSONSerializer{})
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+	root := tr.RootHash()
+
+	for _, key := range [][]byte{[]byte("abcd"), []byte("abdd"), []byte("bbbb")} {
+		proof, present, err := tr.ProveWithPresence(key)
+		assert.Nil(t, err)
+		assert.False(t, present)
+		assert.Nil(t, VerifyAbsence(root, key, proof, &JSONSerializer{}, nil))
+		assert.NotNil(t, VerifyAbsence(root, key, proof, nil, nil))
+		assert.NotNil(t, VerifyAbsence(root, key, proof, &JSONSerializer{}, func(args ...[]byte) []byte {
+			return args[0]
+		}))
+	}
+
+	// an inclusion proof is not an absence proof
+	proof, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrKeyPresent, VerifyAbsence(root, []byte("abbb"), proof, &JSONSerializer{}, nil))
+
+	// a truncated inclusion path doesn't reach the divergence point
+	for i := 1; i < len(proof); i++ {
+		assert.Equal(t, ErrMalformedProof, VerifyAbsence(root, []byte("abbb"), proof[:i], &JSONSerializer{}, nil))
+	}
+
+	// the inclusion path of a sibling key doesn't prove the absence of another key below the same branch
+	assert.NotNil(t, VerifyAbsence(root, []byte("abcc"), proof, &JSONSerializer{}, nil))
+
+	// an empty trie proves the absence of any key
+	assert.Nil(t, VerifyAbsence(nil, []byte("abbb"), nil, nil, nil))
+	assert.Equal(t, ErrMalformedProof, VerifyAbsence(nil, []byte("abbb"), proof, nil, nil))
+}
+
+func benchmarkProofs(b *testing.B) (*Trie, [][]byte, []MerkleProof) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys := make([][]byte, 10000)
+	for i := range keys {
+		keys[i] = hash.Sha3256(byteutils.FromInt64(int64(i)))
+		tr.Put(keys[i], keys[i])
+	}
+	proofs := make([]MerkleProof, len(keys))
+	for i, key := range keys {
+		proofs[i], _ = tr.Prove(key)
+	}
+	return tr, keys, proofs
+}
+
+func BenchmarkTrie_Verify(b *testing.B) {
+	tr, keys, proofs := benchmarkProofs(b)
+	root := tr.RootHash()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := i % len(keys)
+		if err := tr.Verify(root, keys[j], proofs[j]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTrie_VerifyProof(b *testing.B) {
+	tr, keys, proofs := benchmarkProofs(b)
+	root := tr.RootHash()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := i % len(keys)
+		if _, _, err := tr.VerifyProof(root, keys[j], proofs[j]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNodeHasher(t *testing.T) {
+	vals := [][][]byte{
+		{[]byte{byte(leaf)}, []byte{1, 2, 3}, []byte("value")},
+		{[]byte{byte(ext)}, []byte{}, make([]byte, 300)},
+		emptyBranchNode().Val,
+		{[]byte("a"), nil, []byte("b"), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, []byte("c")},
+	}
+	protoHasher := newNodeHasher(&ProtoSerializer{}, nil)
+	jsonHasher := newNodeHasher(&JSONSerializer{}, nil)
+	for _, val := range vals {
+		ir, err := proto.Marshal(&triepb.Node{Val: val})
+		assert.Nil(t, err)
+		h, err := protoHasher.hash(val)
+		assert.Nil(t, err)
+		assert.Equal(t, hash.Sha3256(ir), h)
+
+		ir, err = (&JSONSerializer{}).Serialize(val)
+		assert.Nil(t, err)
+		h, err = jsonHasher.hash(val)
+		assert.Nil(t, err)
+		assert.Equal(t, hash.Sha3256(ir), h)
+	}
+}
+
+func TestTrie_ProveWithSiblings(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+
+	for _, key := range [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abcc")} {
+		proof, siblings, err := tr.ProveWithSiblings(key)
+		assert.Nil(t, err)
+		assert.Nil(t, tr.Verify(tr.RootHash(), key, proof))
+		assert.Equal(t, len(proof), len(siblings))
+
+		route := keyToRoute(key)
+		for i, val := range proof {
+			if len(val) != branchWidth {
+				assert.Equal(t, 0, len(siblings[i]))
+				route = route[len(val[1]):]
+				continue
+			}
+			// reinserting the descended child at its slot gives back the branch node
+			assert.Equal(t, branchWidth-1, len(siblings[i]))
+			slot := int(route[0])
+			rebuilt := append([][]byte{}, siblings[i][:slot]...)
+			rebuilt = append(rebuilt, val[slot])
+			rebuilt = append(rebuilt, siblings[i][slot:]...)
+			assert.Equal(t, val, rebuilt)
+			route = route[1:]
+		}
+	}
+
+	_, _, err := tr.ProveWithSiblings([]byte("zzzz"))
+	assert.NotNil(t, err)
+}
+
+func TestTrie_EmptyRootProof(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(EmptyRootHash(), stor, false)
+	assert.True(t, tr.Empty())
+	assert.True(t, IsEmptyRoot(tr.RootHash()))
+
+	for _, key := range [][]byte{[]byte("aaaa"), []byte{}, nil} {
+		_, err := tr.Prove(key)
+		assert.Equal(t, ErrNotFound, err)
+
+		proof, present, err := tr.ProveWithPresence(key)
+		assert.Nil(t, err)
+		assert.False(t, present)
+		assert.Equal(t, 0, len(proof))
+		assert.Nil(t, VerifyAbsence(EmptyRootHash(), key, proof, nil, nil))
+		_, present, err = tr.VerifyProof(EmptyRootHash(), key, proof)
+		assert.Nil(t, err)
+		assert.False(t, present)
+		assert.Equal(t, ErrKeyNotProven, tr.Verify(EmptyRootHash(), key, proof))
+	}
+
+	// a trie emptied by deletion has the empty root again
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	proof, err := tr.Prove([]byte("aaaa"))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrKeyNotProven, tr.Verify(EmptyRootHash(), []byte("aaaa"), proof))
+	assert.Equal(t, ErrMalformedProof, VerifyAbsence(EmptyRootHash(), []byte("aaaa"), proof, nil, nil))
+	tr.Del([]byte("aaaa"))
+	assert.True(t, IsEmptyRoot(tr.RootHash()))
+	_, err = tr.Prove([]byte("aaaa"))
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestTrie_VerifyErrors(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+	root := tr.RootHash()
+
+	proof, err := tr.Prove([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Nil(t, tr.Verify(root, []byte("abbb"), proof))
+
+	// hash chain broken
+	assert.Equal(t, ErrProofInvalid, tr.Verify([]byte("wrong root"), []byte("abbb"), proof))
+	tampered := append(MerkleProof{}, proof...)
+	leaf := tampered[len(tampered)-1]
+	tampered[len(tampered)-1] = [][]byte{leaf[0], leaf[1], []byte("tampered")}
+	assert.Equal(t, ErrProofInvalid, tr.Verify(root, []byte("abbb"), tampered))
+	assert.Equal(t, ErrProofInvalid, tr.Verify(root, []byte("abbb"), MerkleProof{{[]byte("a"), []byte("b")}}))
+
+	// valid path that doesn't reach the key
+	assert.Equal(t, ErrKeyNotProven, tr.Verify(root, []byte("abbb"), proof[:len(proof)-1]))
+	assert.Equal(t, ErrKeyNotProven, tr.Verify(root, []byte("bbbb"), proof[:1]))
+	assert.Equal(t, ErrKeyNotProven, tr.Verify(root, []byte("abbc"), proof))
+}
+
+func TestTrie_VerifyOversizedExtPath(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+
+	// a forged ext node whose path is longer than the route of the key
+	key := []byte("ab")
+	forged := [][]byte{[]byte{byte(ext)}, append(keyToRoute(key), 1, 2, 3), make([]byte, 32)}
+	root, err := newNodeHasher(tr.serializer, nil).hash(forged)
+	assert.Nil(t, err)
+	assert.True(t, len(forged[1]) > len(keyToRoute(key)))
+
+	proof := MerkleProof{forged}
+	assert.Equal(t, ErrMalformedProof, tr.Verify(root, key, proof))
+	assert.Equal(t, ErrMalformedProof, tr.VerifyFromTrustedRoot(key, proof))
+	assert.Equal(t, ErrMalformedProof, tr.Verify(root, []byte{}, proof))
+}
+
+func TestTrie_ProofLength(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	_, err := tr.ProofLength([]byte("aaaa"))
+	assert.Equal(t, ErrNotFound, err)
+
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abcc"), []byte("bbbb")}
+	for _, key := range keys {
+		tr.Put(key, key)
+	}
+	for _, key := range keys {
+		proof, err := tr.Prove(key)
+		assert.Nil(t, err)
+		length, err := tr.ProofLength(key)
+		assert.Nil(t, err)
+		assert.Equal(t, len(proof), length)
+	}
+
+	for _, key := range [][]byte{[]byte("abcd"), []byte("cccc"), []byte("aaab")} {
+		_, proveErr := tr.Prove(key)
+		_, err := tr.ProofLength(key)
+		assert.Equal(t, proveErr, err)
+	}
+
+	// missing keys, keys extending or cut from a stored key
+	tr, _ = NewTrie(nil, stor, false)
+	tr.Put([]byte{0x12, 0x34}, []byte("v1"))
+	tr.Put([]byte{0x56, 0x78}, []byte("v2"))
+	for _, key := range [][]byte{{0x12, 0x34, 0x56}, {0x56, 0x78, 0x00}, {0x12}, {0x12, 0x35}, {0x99, 0x99}} {
+		_, proveErr := tr.Prove(key)
+		assert.Equal(t, ErrNotFound, proveErr)
+		_, err := tr.ProofLength(key)
+		assert.Equal(t, proveErr, err)
+	}
+}
+
+func TestTrie_ProveWithHashes(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abcc")}
+	for _, key := range keys {
+		tr.Put(key, key)
+	}
+
+	for _, key := range keys {
+		proof, levelHashes, err := tr.ProveWithHashes(key)
+		assert.Nil(t, err)
+		assert.Equal(t, len(proof), len(levelHashes))
+		assert.Equal(t, tr.RootHash(), levelHashes[0])
+		for i, val := range proof {
+			ir, err := proto.Marshal(&triepb.Node{Val: val})
+			assert.Nil(t, err)
+			assert.Equal(t, hash.Sha3256(ir), levelHashes[i])
+		}
+	}
+
+	// adjacent keys share the hashes of their common prefix
+	_, hashesB, _ := tr.ProveWithHashes([]byte("abbb"))
+	_, hashesC, _ := tr.ProveWithHashes([]byte("abcc"))
+	assert.Equal(t, hashesB[:len(hashesB)-1], hashesC[:len(hashesC)-1])
+
+	_, _, err := tr.ProveWithHashes([]byte("zzzz"))
+	assert.NotNil(t, err)
+}
+
+func TestTrie_ProvePrefixKeys(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("ab\x10"), []byte("value1"))
+	tr.Put([]byte("ab\x20"), []byte("value2"))
+	root := tr.RootHash()
+
+	// "ab" ends at a branch node, "ab\x10\x00" extends the leaf of "ab\x10"
+	short, long := []byte("ab"), []byte("ab\x10\x00")
+	for _, key := range [][]byte{short, long} {
+		_, err := tr.Prove(key)
+		assert.Equal(t, ErrNotFound, err)
+		_, err = tr.Del(key)
+		assert.Equal(t, ErrNotFound, err)
+		_, err = tr.Put(key, []byte("value"))
+		assert.NotNil(t, err)
+		assert.Equal(t, root, tr.RootHash())
+
+		proof, present, err := tr.ProveWithPresence(key)
+		assert.Nil(t, err)
+		assert.False(t, present)
+		assert.Nil(t, VerifyAbsence(root, key, proof, nil, nil))
+	}
+	val, err := tr.Get([]byte("ab\x10"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), val)
+
+	// the proof of a key is not accepted for its prefix or its extension
+	proof, err := tr.Prove([]byte("ab\x10"))
+	assert.Nil(t, err)
+	assert.Nil(t, tr.Verify(root, []byte("ab\x10"), proof))
+	assert.NotNil(t, tr.Verify(root, short, proof))
+	assert.NotNil(t, tr.Verify(root, long, proof))
+	assert.Equal(t, ErrKeyPresent, VerifyAbsence(root, []byte("ab\x10"), proof, nil, nil))
+
+	// a key and its byte-prefix proved in separate tries
+	shortTrie, _ := NewTrie(nil, stor, false)
+	shortTrie.Put([]byte("ab"), []byte("short"))
+	longTrie, _ := NewTrie(nil, stor, false)
+	longTrie.Put([]byte("abcd"), []byte("long"))
+	_, err = shortTrie.Put([]byte("abcd"), []byte("long"))
+	assert.NotNil(t, err)
+
+	shortProof, err := shortTrie.Prove([]byte("ab"))
+	assert.Nil(t, err)
+	longProof, err := longTrie.Prove([]byte("abcd"))
+	assert.Nil(t, err)
+	assert.Nil(t, tr.Verify(shortTrie.RootHash(), []byte("ab"), shortProof))
+	assert.Nil(t, tr.Verify(longTrie.RootHash(), []byte("abcd"), longProof))
+	assert.NotNil(t, tr.Verify(shortTrie.RootHash(), []byte("abcd"), shortProof))
+	assert.NotNil(t, tr.Verify(longTrie.RootHash(), []byte("ab"), longProof))
+	_, err = longTrie.Prove([]byte("ab"))
+	assert.Equal(t, ErrNotFound, err)
+	_, err = shortTrie.Prove([]byte("abcd"))
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestTrie_VerifyProofOrdering(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+	tr.Put([]byte("bbbb"), []byte("value4"))
+	root := tr.RootHash()
+	key := []byte("abbb")
+
+	proof, err := tr.Prove(key)
+	assert.Nil(t, err)
+	assert.True(t, len(proof) >= 3)
+	assert.Nil(t, tr.Verify(root, key, proof))
+	other, err := tr.Prove([]byte("bbbb"))
+	assert.Nil(t, err)
+
+	// every reordering of the elements
+	var permute func(prefix MerkleProof, rest MerkleProof)
+	permute = func(prefix MerkleProof, rest MerkleProof) {
+		if len(rest) == 0 {
+			if !reflect.DeepEqual(prefix, proof) {
+				assert.Equal(t, ErrProofInvalid, tr.Verify(root, key, prefix))
+			}
+			return
+		}
+		for i := range rest {
+			next := append(append(MerkleProof{}, rest[:i]...), rest[i+1:]...)
+			permute(append(append(MerkleProof{}, prefix...), rest[i]), next)
+		}
+	}
+	permute(MerkleProof{}, proof)
+
+	for i := range proof {
+		// an element duplicated at any position
+		for j := 0; j <= len(proof); j++ {
+			duplicated := append(append(append(MerkleProof{}, proof[:j]...), proof[i]), proof[j:]...)
+			assert.Equal(t, ErrProofInvalid, tr.Verify(root, key, duplicated), "duplicate %d at %d", i, j)
+		}
+		// an element dropped and the proof padded back to its length
+		dropped := append(append(MerkleProof{}, proof[:i]...), proof[i+1:]...)
+		for _, pad := range [][][]byte{proof[len(proof)-1], other[len(other)-1], other[0]} {
+			padded := append(append(MerkleProof{}, dropped...), pad)
+			if reflect.DeepEqual(padded, proof) {
+				continue
+			}
+			assert.Equal(t, ErrProofInvalid, tr.Verify(root, key, padded), "drop %d", i)
+		}
+		// an element of another proof inserted
+		inserted := append(append(append(MerkleProof{}, proof[:i]...), other[len(other)-1]), proof[i:]...)
+		assert.Equal(t, ErrProofInvalid, tr.Verify(root, key, inserted))
+	}
+}
+
+func TestTrie_VerifyFromRootNode(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abdd"), []byte("bbbb")}
+	for _, key := range keys {
+		tr.Put(key, append([]byte("value-"), key...))
+	}
+	rootIR, err := stor.Get(tr.RootHash())
+	assert.Nil(t, err)
+
+	for _, key := range keys {
+		proof, err := tr.Prove(key)
+		assert.Nil(t, err)
+		assert.Nil(t, tr.Verify(tr.RootHash(), key, proof))
+
+		value, err := tr.VerifyFromRootNode(rootIR, key, proof)
+		assert.Nil(t, err)
+		assert.Equal(t, append([]byte("value-"), key...), value)
+
+		// the root node may be left out of the proof
+		value, err = tr.VerifyFromRootNode(rootIR, key, proof[1:])
+		assert.Nil(t, err)
+		assert.Equal(t, append([]byte("value-"), key...), value)
+	}
+
+	proof, _ := tr.Prove(keys[0])
+	_, err = tr.VerifyFromRootNode(rootIR, keys[1], proof)
+	assert.Equal(t, tr.Verify(tr.RootHash(), keys[1], proof), err)
+	_, err = tr.VerifyFromRootNode(nil, keys[0], proof)
+	assert.Equal(t, ErrMalformedProof, err)
+
+	// another root node doesn't match the proof
+	tr.Put([]byte("cccc"), []byte("value"))
+	otherIR, _ := stor.Get(tr.RootHash())
+	_, err = tr.VerifyFromRootNode(otherIR, keys[0], proof)
+	assert.Equal(t, tr.Verify(tr.RootHash(), keys[0], proof), err)
+	assert.NotNil(t, err)
+	_, err = tr.VerifyFromRootNode(otherIR, keys[0], proof[1:])
+	assert.NotNil(t, err)
+}
+
+func TestTrie_ProofStats(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	assert.Equal(t, ProofStats{}, tr.ProofStats())
+
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abdd"), []byte("bbbb")}
+	for _, key := range keys {
+		tr.Put(key, key)
+	}
+	depth, size := 0, 0
+	for _, key := range keys {
+		proof, err := tr.Prove(key)
+		assert.Nil(t, err)
+		depth += len(proof)
+		for _, val := range proof {
+			for _, v := range val {
+				size += len(v)
+			}
+		}
+	}
+	// a failed proof isn't counted
+	_, err := tr.Prove([]byte("cccc"))
+	assert.NotNil(t, err)
+
+	stats := tr.ProofStats()
+	assert.Equal(t, uint64(4), stats.Proofs)
+	assert.Equal(t, float64(depth)/4, stats.AvgDepth)
+	assert.Equal(t, float64(size)/4, stats.AvgBytes)
+	assert.Equal(t, 0.0, stats.CacheHitRate)
+
+	assert.Nil(t, tr.EnableProofCache(16))
+	tr.Prove(keys[0])
+	tr.Prove(keys[0])
+	tr.Prove(keys[0])
+	tr.Prove(keys[1])
+	stats = tr.ProofStats()
+	assert.Equal(t, uint64(8), stats.Proofs)
+	assert.Equal(t, 0.5, stats.CacheHitRate)
+
+	// concurrent provers update the counters without losing any
+	tr, _ = NewTrie(tr.RootHash(), stor, false)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, key := range keys {
+				tr.Prove(key)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(32), tr.ProofStats().Proofs)
+
+	// with the cache on, concurrent provers are the first to see a new root
+	assert.Nil(t, tr.EnableProofCache(16))
+	tr.Put([]byte("eeee"), []byte("value5"))
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, key := range keys {
+				proof, err := tr.Prove(key)
+				assert.Nil(t, err)
+				assert.Nil(t, tr.Verify(tr.RootHash(), key, proof))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(64), tr.ProofStats().Proofs)
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"encoding/json"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/nebulasio/go-nebulas/common/trie/pb"
+	"github.com/nebulasio/go-nebulas/util/byteutils"
+)
+
+// Serializer encodes trie nodes into the bytes stored and hashed,
+// a trie must be read with the same serializer it was written with
+type Serializer interface {
+	Serialize(val [][]byte) ([]byte, error)
+	Deserialize(data []byte) ([][]byte, error)
+}
+
+// ProtoSerializer is the production serializer of trie nodes
+type ProtoSerializer struct{}
+
+// Serialize node value into protobuf bytes
+func (s *ProtoSerializer) Serialize(val [][]byte) ([]byte, error) {
+	return proto.Marshal(&triepb.Node{Val: val})
+}
+
+// Deserialize protobuf bytes into node value
+func (s *ProtoSerializer) Deserialize(data []byte) ([][]byte, error) {
+	pb := new(triepb.Node)
+	if err := proto.Unmarshal(data, pb); err != nil {
+		return nil, err
+	}
+	return pb.Val, nil
+}
+
+// JSONSerializer encodes node value as a json array of hex strings,
+// it's human-readable and only meant for debugging and test fixtures
+type JSONSerializer struct{}
+
+// Serialize node value into json bytes
+func (s *JSONSerializer) Serialize(val [][]byte) ([]byte, error) {
+	hexes := make([]string, len(val))
+	for i, v := range val {
+		hexes[i] = byteutils.Hex(v)
+	}
+	return json.Marshal(hexes)
+}
+
+// Deserialize json bytes into node value
+func (s *JSONSerializer) Deserialize(data []byte) ([][]byte, error) {
+	var hexes []string
+	if err := json.Unmarshal(data, &hexes); err != nil {
+		return nil, err
+	}
+	val := make([][]byte, len(hexes))
+	for i, h := range hexes {
+		if len(h) == 0 {
+			continue
+		}
+		v, err := byteutils.FromHex(h)
+		if err != nil {
+			return nil, err
+		}
+		val[i] = v
+	}
+	return val, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerializer_RoundTrip(t *testing.T) {
+	vals := [][][]byte{
+		[][]byte{[]byte{byte(leaf)}, []byte{0x1, 0x2}, []byte("value")},
+		[][]byte{[]byte{byte(ext)}, []byte{0x3}, []byte("next hash")},
+		emptyBranchNode().Val,
+	}
+	vals[2][5] = []byte("child hash")
+
+	for _, s := range []Serializer{&ProtoSerializer{}, &JSONSerializer{}} {
+		for _, val := range vals {
+			data, err := s.Serialize(val)
+			assert.Nil(t, err)
+			got, err := s.Deserialize(data)
+			assert.Nil(t, err)
+			assert.Equal(t, len(val), len(got))
+			for i := range val {
+				assert.Equal(t, string(val[i]), string(got[i]))
+			}
+		}
+	}
+
+	data, _ := (&JSONSerializer{}).Serialize(vals[0])
+	assert.Equal(t, `["02","0102","76616c7565"]`, string(data))
+}
+
+func TestTrie_JSONSerializer(t *testing.T) {
+	stor1, _ := storage.NewMemoryStorage()
+	tr1, _ := NewTrie(nil, stor1, false)
+	stor2, _ := storage.NewMemoryStorage()
+	tr2, err := NewTrieWithSerializer(nil, stor2, false, &JSONSerializer{})
+	assert.Nil(t, err)
+
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abcc")}
+	for _, key := range keys {
+		tr1.Put(key, key)
+		tr2.Put(key, key)
+	}
+	assert.NotEqual(t, tr1.RootHash(), tr2.RootHash())
+
+	for _, key := range keys {
+		val, err := tr2.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, key, val)
+
+		proof, err := tr1.Prove(key)
+		assert.Nil(t, err)
+		assert.Nil(t, tr1.Verify(tr1.RootHash(), key, proof))
+
+		proof, err = tr2.Prove(key)
+		assert.Nil(t, err)
+		assert.Nil(t, tr2.Verify(tr2.RootHash(), key, proof))
+	}
+}
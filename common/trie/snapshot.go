@@ -0,0 +1,97 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/nebulasio/go-nebulas/storage"
+)
+
+// Export write all key/value pairs of the trie into w in key order,
+// each pair is encoded as [uvarint len(key), key, uvarint len(value), value]
+func (t *Trie) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+	write := func(data []byte) error {
+		n := binary.PutUvarint(buf, uint64(len(data)))
+		if _, err := bw.Write(buf[:n]); err != nil {
+			return err
+		}
+		_, err := bw.Write(data)
+		return err
+	}
+	err := t.Walk(func(key, value []byte) error {
+		if err := write(key); err != nil {
+			return err
+		}
+		return write(value)
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportTrie build a new trie in storage from the key/value pairs written by Export
+func ImportTrie(storage storage.Storage, r io.Reader) (*Trie, error) {
+	t, err := NewTrie(nil, storage, false)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	read := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		// the length comes from the stream, grow the buffer as the bytes arrive
+		// instead of allocating it up front
+		data := new(bytes.Buffer)
+		if _, err := io.CopyN(data, br, int64(l)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return data.Bytes(), nil
+	}
+	for {
+		key, err := read()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := read()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if _, err := t.Put(key, value); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_ExportImport(t *testing.T) {
+	stor1, _ := storage.NewMemoryStorage()
+	tr1, _ := NewTrie(nil, stor1, false)
+	for i := 100; i < 300; i++ {
+		key := []byte("abcdeffkey" + strconv.Itoa(i))
+		tr1.Put(key, []byte("value"+strconv.Itoa(i)))
+	}
+	tr1.Put([]byte("abcdeffkey999"), []byte{})
+
+	buf := new(bytes.Buffer)
+	assert.Nil(t, tr1.Export(buf))
+
+	stor2, _ := storage.NewMemoryStorage()
+	tr2, err := ImportTrie(stor2, bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, tr1.RootHash(), tr2.RootHash())
+
+	// truncated snapshot
+	_, err = ImportTrie(stor2, bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// corrupt length, far larger than the snapshot
+	corrupt := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(corrupt, math.MaxInt64)
+	_, err = ImportTrie(stor2, bytes.NewReader(append(corrupt[:n], 'k')))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// empty trie
+	empty, _ := NewTrie(nil, stor1, false)
+	buf.Reset()
+	assert.Nil(t, empty.Export(buf))
+	tr3, err := ImportTrie(stor2, buf)
+	assert.Nil(t, err)
+	assert.True(t, tr3.Empty())
+}
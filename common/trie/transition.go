@@ -0,0 +1,183 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/storage"
+)
+
+// Errors
+var (
+	ErrTransitionMismatch = errors.New("applying the changes doesn't yield the new root")
+	ErrIncompleteWitness  = errors.New("transition proof misses a node needed to apply the changes")
+)
+
+// KV is a change of a key, a nil Value deletes the key
+type KV struct {
+	Key   []byte
+	Value []byte
+}
+
+// TransitionProof holds the nodes of the old trie read when applying a set of changes,
+// with them a client without the state can replay the changes from the old root
+type TransitionProof struct {
+	// Nodes are the serialized nodes, sorted by their hash
+	Nodes [][]byte
+}
+
+// witnessStorage record the nodes read from base, writes are kept in memory
+// and never reach base
+type witnessStorage struct {
+	base   NodeReader
+	reads  map[string][]byte
+	writes map[string][]byte
+}
+
+func newWitnessStorage(base NodeReader) *witnessStorage {
+	return &witnessStorage{
+		base:   base,
+		reads:  make(map[string][]byte),
+		writes: make(map[string][]byte),
+	}
+}
+
+func (s *witnessStorage) Get(key []byte) ([]byte, error) {
+	if val, ok := s.writes[string(key)]; ok {
+		return val, nil
+	}
+	val, err := s.base.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	s.reads[string(key)] = val
+	return val, nil
+}
+
+func (s *witnessStorage) Put(key []byte, value []byte) error {
+	s.writes[string(key)] = value
+	return nil
+}
+
+func (s *witnessStorage) Del(key []byte) error {
+	delete(s.writes, string(key))
+	return nil
+}
+
+func (s *witnessStorage) EnableBatch() {}
+
+func (s *witnessStorage) DisableBatch() {}
+
+func (s *witnessStorage) Flush() error {
+	return nil
+}
+
+// applyChanges apply the changes on the trie at oldRoot over stor and return the new root,
+// deleting a key not in the trie is a no-op
+func (t *Trie) applyChanges(oldRoot []byte, changes []KV, stor storage.Storage) ([]byte, error) {
+	tr := &Trie{
+		rootHash:      oldRoot,
+		storage:       stor,
+		maxProofDepth: t.maxProofDepth,
+		serializer:    t.serializer,
+	}
+	for _, kv := range changes {
+		var err error
+		if kv.Value == nil {
+			_, err = tr.Del(kv.Key)
+			if err == ErrNotFound {
+				err = nil
+			}
+		} else {
+			_, err = tr.Put(kv.Key, kv.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tr.rootHash, nil
+}
+
+// sameRoot return whether the roots are equal, all empty roots are the same
+func sameRoot(a, b []byte) bool {
+	if IsEmptyRoot(a) || IsEmptyRoot(b) {
+		return IsEmptyRoot(a) && IsEmptyRoot(b)
+	}
+	return bytes.Equal(a, b)
+}
+
+// ProveTransition prove that applying changes in order to the trie at oldRoot yields newRoot.
+// The nodes of oldRoot must be in the storage of the trie, the trie itself is untouched.
+func (t *Trie) ProveTransition(oldRoot, newRoot []byte, changes []KV) (*TransitionProof, error) {
+	stor := newWitnessStorage(t.storage)
+	root, err := t.applyChanges(oldRoot, changes, stor)
+	if err != nil {
+		return nil, err
+	}
+	if !sameRoot(root, newRoot) {
+		return nil, ErrTransitionMismatch
+	}
+
+	hashes := make([]string, 0, len(stor.reads))
+	for h := range stor.reads {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+	proof := &TransitionProof{Nodes: make([][]byte, len(hashes))}
+	for i, h := range hashes {
+		proof.Nodes[i] = stor.reads[h]
+	}
+	return proof, nil
+}
+
+// index resolve the nodes of the proof by their hash, ErrIncompleteWitness is returned for a missing node
+// and ErrNotFound for the empty slot of a branch
+func (proof *TransitionProof) index() NodeResolver {
+	nodes := make(map[string][]byte, len(proof.Nodes))
+	for _, n := range proof.Nodes {
+		nodes[string(hash.Sha3256(n))] = n
+	}
+	return func(h []byte) ([]byte, error) {
+		if n, ok := nodes[string(h)]; ok {
+			return n, nil
+		}
+		if len(h) == 0 {
+			return nil, ErrNotFound
+		}
+		return nil, ErrIncompleteWitness
+	}
+}
+
+// VerifyTransition verify that applying changes in order to the trie at oldRoot yields newRoot,
+// using only the nodes in proof. The nodes are indexed by their own hash, so a forged node
+// is never reached from oldRoot, and ErrIncompleteWitness is returned if a node is missing.
+func (t *Trie) VerifyTransition(oldRoot, newRoot []byte, changes []KV, proof *TransitionProof) error {
+	root, err := t.applyChanges(oldRoot, changes, newWitnessStorage(proof.index()))
+	if err != nil {
+		return err
+	}
+	if !sameRoot(root, newRoot) {
+		return ErrTransitionMismatch
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_ProveTransition(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+	tr.Put([]byte("bbbb"), []byte("value4"))
+	oldRoot := tr.RootHash()
+
+	changes := []KV{
+		{Key: []byte("abbb"), Value: []byte("updated")},
+		{Key: []byte("abcc"), Value: nil},
+		{Key: []byte("cccc"), Value: []byte("value5")},
+		{Key: []byte("dddd"), Value: nil},
+	}
+	next, _ := tr.Clone()
+	next.Put([]byte("abbb"), []byte("updated"))
+	next.Del([]byte("abcc"))
+	next.Put([]byte("cccc"), []byte("value5"))
+	newRoot := next.RootHash()
+
+	proof, err := tr.ProveTransition(oldRoot, newRoot, changes)
+	assert.Nil(t, err)
+	assert.Equal(t, oldRoot, tr.RootHash())
+	assert.NotEmpty(t, proof.Nodes)
+
+	// a stateless verifier only has the roots, the changes and the proof
+	emptyStor, _ := storage.NewMemoryStorage()
+	verifier, _ := NewTrie(nil, emptyStor, false)
+	assert.Nil(t, verifier.VerifyTransition(oldRoot, newRoot, changes, proof))
+
+	assert.Equal(t, ErrTransitionMismatch, verifier.VerifyTransition(oldRoot, oldRoot, changes, proof))
+	wrong := append([]KV{}, changes...)
+	wrong[0] = KV{Key: []byte("abbb"), Value: []byte("forged")}
+	assert.Equal(t, ErrTransitionMismatch, verifier.VerifyTransition(oldRoot, newRoot, wrong, proof))
+
+	_, err = tr.ProveTransition(oldRoot, oldRoot, changes)
+	assert.Equal(t, ErrTransitionMismatch, err)
+
+	// every node is needed, a missing or tampered node can't be used
+	for i := range proof.Nodes {
+		missing := &TransitionProof{Nodes: append(append([][]byte{}, proof.Nodes[:i]...), proof.Nodes[i+1:]...)}
+		assert.Equal(t, ErrIncompleteWitness, verifier.VerifyTransition(oldRoot, newRoot, changes, missing))
+
+		tampered := &TransitionProof{Nodes: append([][]byte{}, proof.Nodes...)}
+		tampered.Nodes[i] = append(append([]byte{}, proof.Nodes[i]...), 0)
+		assert.Equal(t, ErrIncompleteWitness, verifier.VerifyTransition(oldRoot, newRoot, changes, tampered))
+	}
+
+	// a change outside the proved paths needs nodes that aren't in the proof
+	more := append(append([]KV{}, changes...), KV{Key: []byte("aaaa"), Value: nil})
+	assert.Equal(t, ErrIncompleteWitness, verifier.VerifyTransition(oldRoot, newRoot, more, proof))
+}
+
+func TestTrie_ProveTransitionFromEmpty(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	changes := []KV{
+		{Key: []byte("aaaa"), Value: []byte("value1")},
+		{Key: []byte("abbb"), Value: []byte("value2")},
+	}
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+	newRoot := tr.RootHash()
+
+	proof, err := tr.ProveTransition(nil, newRoot, changes)
+	assert.Nil(t, err)
+	assert.Empty(t, proof.Nodes)
+	assert.Nil(t, tr.VerifyTransition(nil, newRoot, changes, proof))
+
+	// deleting all the keys goes back to the empty root
+	removes := []KV{{Key: []byte("aaaa")}, {Key: []byte("abbb")}}
+	proof, err = tr.ProveTransition(newRoot, EmptyRootHash(), removes)
+	assert.Nil(t, err)
+	assert.Nil(t, tr.VerifyTransition(newRoot, nil, removes, proof))
+}
@@ -19,9 +19,14 @@
 package trie
 
 import (
+	"bytes"
 	"errors"
+	"sort"
+	"strconv"
+	"sync"
 
 	"github.com/gogo/protobuf/proto"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/nebulasio/go-nebulas/common/trie/pb"
 	"github.com/nebulasio/go-nebulas/crypto/hash"
 	"github.com/nebulasio/go-nebulas/storage"
@@ -31,6 +36,7 @@ import (
 var (
 	ErrNotFound           = storage.ErrKeyNotFound
 	ErrInvalidProtoToNode = errors.New("Pb Message cannot be converted into Trie Node")
+	ErrNodesNotTracked    = errors.New("new nodes are not tracked, call TrackNewNodes first")
 )
 
 // Action represents operation types in Trie
@@ -51,6 +57,9 @@ type Entry struct {
 	update []byte
 }
 
+// branchWidth is the number of slots in a branch node, one for each nibble of the route
+const branchWidth = 16
+
 // Flag to identify the type of node
 type ty int
 
@@ -61,6 +70,19 @@ const (
 	branch
 )
 
+func (f ty) String() string {
+	switch f {
+	case ext:
+		return "ext"
+	case leaf:
+		return "leaf"
+	case branch:
+		return "branch"
+	default:
+		return "unknown"
+	}
+}
+
 // Node in trie, three kinds,
 // Branch Node [hash_0, hash_1, ..., hash_f]
 // Extension Node [flag, encodedPath, next hash]
@@ -100,15 +122,15 @@ func (n *node) Type() (ty, error) {
 		return unknown, errors.New("nil node")
 	}
 	switch len(n.Val) {
-	case 16: // Branch Node
+	case branchWidth: // Branch Node
 		return branch, nil
 	case 3: // Extension Node or Leaf Node
-		if n.Val[0] == nil {
+		if len(n.Val[0]) == 0 {
 			return unknown, errors.New("unknown node type")
 		}
 		return ty(n.Val[0][0]), nil
 	default:
-		return unknown, errors.New("wrong node value, expect [16][]byte or [3][]byte, get [" + string(len(n.Val)) + "][]byte")
+		return unknown, errors.New("wrong node value, expect [" + strconv.Itoa(branchWidth) + "][]byte or [3][]byte, get [" + strconv.Itoa(len(n.Val)) + "][]byte")
 	}
 }
 
@@ -117,10 +139,21 @@ func (n *node) Type() (ty, error) {
 // Extension Node: 3-elements array, value is [ext flag, prefix path, next hash]
 // Leaf Node: 3-elements array, value is [leaf flag, suffix path, value]
 type Trie struct {
+	// counters come first to keep the 64-bit atomics aligned
+	counters      proofCounters
 	rootHash      []byte
 	storage       storage.Storage
 	changelog     []*Entry
 	needChangelog bool
+	versioning    bool
+	maxProofDepth int
+	serializer    Serializer
+
+	proofCache     *lru.Cache
+	muProofCache   sync.Mutex
+	proofCacheRoot []byte
+
+	newNodes map[string][]byte
 }
 
 // CreateNode in trie
@@ -133,45 +166,70 @@ func (t *Trie) createNode(val [][]byte) (*node, error) {
 }
 
 // FetchNode in trie
-func (t *Trie) fetchNode(hash []byte) (*node, error) {
-	ir, err := t.storage.Get(hash)
+func (t *Trie) fetchNode(h []byte) (*node, error) {
+	ir, err := t.storage.Get(h)
 
 	if err != nil {
 		return nil, err
 	}
 
-	pb := new(triepb.Node)
-	if err := proto.Unmarshal(ir, pb); err != nil {
+	val, err := t.serializer.Deserialize(ir)
+	if err != nil {
 		return nil, err
 	}
-	n := new(node)
-	if err := n.FromProto(pb); err != nil {
-		return nil, err
+	n := &node{
+		Hash:  hash.Sha3256(ir),
+		Bytes: ir,
+		Val:   val,
 	}
 	return n, nil
 }
 
 // CommitNode node in trie into storage
 func (t *Trie) commitNode(n *node) error {
-	pb, err := n.ToProto()
-	if err != nil {
-		return err
-	}
-	n.Bytes, err = proto.Marshal(pb)
+	var err error
+	n.Bytes, err = t.serializer.Serialize(n.Val)
 	if err != nil {
 		return err
 	}
 	n.Hash = hash.Sha3256(n.Bytes)
 
+	if t.newNodes != nil {
+		t.newNodes[string(n.Hash)] = n.Bytes
+	}
 	return t.storage.Put(n.Hash, n.Bytes)
 }
 
+// TrackNewNodes start recording the nodes written into storage,
+// the recorded nodes are returned by CommitWithNodes
+func (t *Trie) TrackNewNodes() {
+	t.newNodes = make(map[string][]byte)
+}
+
+// CommitWithNodes return the root hash and the nodes written since TrackNewNodes
+// or the last CommitWithNodes, keyed by the raw node hash. A peer which puts all
+// the nodes into its storage can open the trie at the returned root.
+func (t *Trie) CommitWithNodes() ([]byte, map[string][]byte, error) {
+	if t.newNodes == nil {
+		return nil, nil, ErrNodesNotTracked
+	}
+	nodes := t.newNodes
+	t.newNodes = make(map[string][]byte)
+	return t.rootHash, nodes, nil
+}
+
 // NewTrie if rootHash is nil, create a new Trie, otherwise, build an existed trie
 func NewTrie(rootHash []byte, storage storage.Storage, needChangelog bool) (*Trie, error) {
+	return NewTrieWithSerializer(rootHash, storage, needChangelog, &ProtoSerializer{})
+}
+
+// NewTrieWithSerializer is same as NewTrie, but nodes are encoded by the given serializer
+func NewTrieWithSerializer(rootHash []byte, storage storage.Storage, needChangelog bool, serializer Serializer) (*Trie, error) {
 	t := &Trie{
 		rootHash:      rootHash,
 		storage:       storage,
 		needChangelog: needChangelog,
+		serializer:    serializer,
 	}
 	if t.rootHash == nil || len(t.rootHash) == 0 {
 		return t, nil
@@ -181,14 +239,103 @@ func NewTrie(rootHash []byte, storage storage.Storage, needChangelog bool) (*Tri
 	return t, nil
 }
 
+// NodeType return the type of the node in storage, "branch", "ext" or "leaf"
+func (t *Trie) NodeType(hash []byte) (string, error) {
+	n, err := t.fetchNode(hash)
+	if err != nil {
+		return "", err
+	}
+	flag, err := n.Type()
+	if err != nil {
+		return "", err
+	}
+	if flag != branch && flag != ext && flag != leaf {
+		return "", errors.New("unknown node type")
+	}
+	return flag.String(), nil
+}
+
+// NodeChildren return the child hashes of the branch or ext node in storage,
+// empty slots of a branch node are skipped, a leaf node has no children
+func (t *Trie) NodeChildren(hash []byte) ([][]byte, error) {
+	n, err := t.fetchNode(hash)
+	if err != nil {
+		return nil, err
+	}
+	return n.children()
+}
+
+// Size return the serialized bytes of all the nodes reachable from the root
+func (t *Trie) Size() (int64, error) {
+	if t.Empty() {
+		return 0, nil
+	}
+	return t.size(t.rootHash)
+}
+
+func (t *Trie) size(hash []byte) (int64, error) {
+	n, err := t.fetchNode(hash)
+	if err != nil {
+		return 0, err
+	}
+	children, err := n.children()
+	if err != nil {
+		return 0, err
+	}
+	size := int64(len(n.Bytes))
+	for _, child := range children {
+		s, err := t.size(child)
+		if err != nil {
+			return 0, err
+		}
+		size += s
+	}
+	return size, nil
+}
+
+// children return the hashes of the child nodes
+func (n *node) children() ([][]byte, error) {
+	flag, err := n.Type()
+	if err != nil {
+		return nil, err
+	}
+	switch flag {
+	case branch:
+		children := [][]byte{}
+		for _, child := range n.Val {
+			if len(child) > 0 {
+				children = append(children, child)
+			}
+		}
+		return children, nil
+	case ext:
+		return [][]byte{n.Val[2]}, nil
+	case leaf:
+		return [][]byte{}, nil
+	default:
+		return nil, errors.New("unknown node type")
+	}
+}
+
 // RootHash return the rootHash of trie
 func (t *Trie) RootHash() []byte {
 	return t.rootHash
 }
 
+// EmptyRootHash return the canonical root hash of an empty trie,
+// use IsEmptyRoot to check a root hash
+func EmptyRootHash() []byte {
+	return nil
+}
+
+// IsEmptyRoot return if the root hash is the root of an empty trie
+func IsEmptyRoot(rootHash []byte) bool {
+	return len(rootHash) == 0
+}
+
 // Empty return if the trie is empty
 func (t *Trie) Empty() bool {
-	return t.rootHash == nil
+	return IsEmptyRoot(t.rootHash)
 }
 
 // Get the value to the key in trie
@@ -196,6 +343,42 @@ func (t *Trie) Get(key []byte) ([]byte, error) {
 	return t.get(t.rootHash, keyToRoute(key))
 }
 
+// HashOfKey return the hash of the leaf node of the key, it's the hash of the last node
+// in the proof of the key. ErrNotFound is returned if the key doesn't exist
+func (t *Trie) HashOfKey(key []byte) ([]byte, error) {
+	c := t.NewCursor(key)
+	for {
+		ok, err := c.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+	}
+	if !c.Found() {
+		return nil, ErrNotFound
+	}
+	return c.Step().Hash, nil
+}
+
+// GetInto get the value to the key in trie and decode it into out,
+// ErrNotFound is returned if the key doesn't exist, otherwise the error of decode
+func (t *Trie) GetInto(key []byte, out interface{}, decode func([]byte, interface{}) error) error {
+	val, err := t.Get(key)
+	if err != nil {
+		return err
+	}
+	return decode(val, out)
+}
+
+// GetProto get the value to the key in trie and unmarshal it into the protobuf message
+func (t *Trie) GetProto(key []byte, msg proto.Message) error {
+	return t.GetInto(key, msg, func(data []byte, out interface{}) error {
+		return proto.Unmarshal(data, out.(proto.Message))
+	})
+}
+
 func (t *Trie) get(rootHash []byte, route []byte) ([]byte, error) {
 	curRootHash := rootHash
 	curRoute := route
@@ -246,6 +429,9 @@ func (t *Trie) Put(key []byte, val []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := t.recordVersion(newHash, key); err != nil {
+		return nil, err
+	}
 	t.rootHash = newHash
 
 	if t.needChangelog {
@@ -288,6 +474,9 @@ func (t *Trie) update(root []byte, route []byte, val []byte) ([]byte, error) {
 
 // add new node to one branch of branch node's 16 branches according to route
 func (t *Trie) updateWhenMeetBranch(rootNode *node, route []byte, val []byte) ([]byte, error) {
+	if len(route) == 0 {
+		return nil, errors.New("wrong key, too short")
+	}
 	// update sub-trie
 	newHash, err := t.update(rootNode.Val[route[0]], route[1:], val)
 	if err != nil {
@@ -458,6 +647,9 @@ func (t *Trie) Del(key []byte) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := t.recordVersion(newHash, key); err != nil {
+		return nil, err
+	}
 	t.rootHash = newHash
 
 	if t.needChangelog {
@@ -467,6 +659,178 @@ func (t *Trie) Del(key []byte) ([]byte, error) {
 	return newHash, nil
 }
 
+// DeleteBatch delete all the keys' values in trie in one pass, every node on the paths
+// of the keys is rebuilt and committed once. Duplicate keys are deleted once. If any key
+// is not in the trie, ErrNotFound is returned and the trie is left unchanged
+func (t *Trie) DeleteBatch(keys [][]byte) ([]byte, error) {
+	seen := make(map[string]bool, len(keys))
+	unique := make([][]byte, 0, len(keys))
+	routes := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			unique = append(unique, key)
+			routes = append(routes, keyToRoute(key))
+		}
+	}
+	if len(routes) == 0 {
+		return t.rootHash, nil
+	}
+	sort.Slice(routes, func(i, j int) bool { return bytes.Compare(routes[i], routes[j]) < 0 })
+
+	root, err := t.delBatch(t.rootHash, routes)
+	if err != nil {
+		return nil, err
+	}
+	var newHash []byte
+	if root != nil {
+		if err := t.commitIfChanged(root); err != nil {
+			return nil, err
+		}
+		newHash = root.Hash
+	}
+	if err := t.recordVersion(newHash, unique...); err != nil {
+		return nil, err
+	}
+	t.rootHash = newHash
+
+	if t.needChangelog {
+		for _, key := range unique {
+			entry := &Entry{Delete, key, nil, nil}
+			t.changelog = append(t.changelog, entry)
+		}
+	}
+	return newHash, nil
+}
+
+// delBatch delete the sorted distinct routes below root and return the new root node of
+// the sub-trie, nil if the sub-trie is now empty. Rebuilt nodes are not committed,
+// their Hash is nil, so that a parent collapsing them doesn't leave a stale node in storage
+func (t *Trie) delBatch(root []byte, routes [][]byte) (*node, error) {
+	if len(root) == 0 {
+		return nil, ErrNotFound
+	}
+	rootNode, err := t.fetchNode(root)
+	if err != nil {
+		return nil, err
+	}
+	flag, err := rootNode.Type()
+	if err != nil {
+		return nil, err
+	}
+	switch flag {
+	case branch:
+		// the routes are sorted, those going through the same slot are next to each other
+		children := make(map[int]*node)
+		for i := 0; i < len(routes); {
+			// the key is a prefix of the keys below
+			if len(routes[i]) == 0 {
+				return nil, ErrNotFound
+			}
+			idx := routes[i][0]
+			sub := make([][]byte, 0)
+			for ; i < len(routes) && len(routes[i]) > 0 && routes[i][0] == idx; i++ {
+				sub = append(sub, routes[i][1:])
+			}
+			child, err := t.delBatch(rootNode.Val[idx], sub)
+			if err != nil {
+				return nil, err
+			}
+			children[int(idx)] = child
+			if child == nil {
+				rootNode.Val[idx] = nil
+			}
+		}
+
+		// remove empty branch node
+		if isEmptyBranch(rootNode) {
+			return nil, nil
+		}
+		if lenBranch(rootNode) == 1 {
+			for idx := range rootNode.Val {
+				if len(rootNode.Val[idx]) == 0 {
+					continue
+				}
+				child, ok := children[idx]
+				if !ok {
+					if child, err = t.fetchNode(rootNode.Val[idx]); err != nil {
+						return nil, err
+					}
+				}
+				return t.collapse([]byte{byte(idx)}, child)
+			}
+		}
+		for idx, child := range children {
+			if child == nil {
+				continue
+			}
+			if err := t.commitIfChanged(child); err != nil {
+				return nil, err
+			}
+			rootNode.Val[idx] = child.Hash
+		}
+		rootNode.Hash = nil
+		return rootNode, nil
+
+	case ext:
+		path := rootNode.Val[1]
+		sub := make([][]byte, len(routes))
+		for i, route := range routes {
+			if prefixLen(path, route) != len(path) {
+				return nil, ErrNotFound
+			}
+			sub[i] = route[len(path):]
+		}
+		child, err := t.delBatch(rootNode.Val[2], sub)
+		if err != nil {
+			return nil, err
+		}
+		// remove empty ext node
+		if child == nil {
+			return nil, nil
+		}
+		return t.collapse(path, child)
+
+	case leaf:
+		if len(routes) != 1 || !bytes.Equal(rootNode.Val[1], routes[0]) {
+			return nil, ErrNotFound
+		}
+		return nil, nil
+	default:
+		return nil, errors.New("unknown node type")
+	}
+}
+
+// collapse return the node replacing an ext or a single child branch with the path in
+// front of child: ext->ext and ext->leaf merge into the child, ext->branch stays an ext
+func (t *Trie) collapse(path []byte, child *node) (*node, error) {
+	flag, err := child.Type()
+	if err != nil {
+		return nil, err
+	}
+	switch flag {
+	case branch:
+		if err := t.commitIfChanged(child); err != nil {
+			return nil, err
+		}
+		return &node{Val: [][]byte{[]byte{byte(ext)}, path, child.Hash}}, nil
+	case ext, leaf:
+		child.Val[1] = append(append([]byte{}, path...), child.Val[1]...)
+		child.Hash = nil
+		return child, nil
+	default:
+		return nil, errors.New("unknown node type")
+	}
+}
+
+// commitIfChanged commit the node unless it's unchanged since it was fetched
+func (t *Trie) commitIfChanged(n *node) error {
+	if n.Hash != nil {
+		return nil
+	}
+	return t.commitNode(n)
+}
+
 func (t *Trie) del(root []byte, route []byte) ([]byte, error) {
 	if root == nil || len(root) == 0 {
 		return nil, ErrNotFound
@@ -482,6 +846,10 @@ func (t *Trie) del(root []byte, route []byte) ([]byte, error) {
 	}
 	switch flag {
 	case branch:
+		// the key is a prefix of the keys below
+		if len(route) == 0 {
+			return nil, ErrNotFound
+		}
 		newHash, err := t.del(rootNode.Val[route[0]], route[1:])
 		if err != nil {
 			return nil, err
@@ -535,7 +903,7 @@ func (t *Trie) del(root []byte, route []byte) ([]byte, error) {
 	case leaf:
 		path := rootNode.Val[1]
 		matchLen := prefixLen(path, route)
-		if matchLen != len(path) {
+		if matchLen != len(path) || matchLen != len(route) {
 			return nil, ErrNotFound
 		}
 		return nil, nil
@@ -616,12 +984,12 @@ func (t *Trie) deleteWhenMeetSingleBranch(rootNode *node) ([]byte, error) {
 
 // Clone the trie to create a new trie sharing the same storage
 func (t *Trie) Clone() (*Trie, error) {
-	return &Trie{rootHash: t.rootHash, storage: t.storage, needChangelog: t.needChangelog}, nil
+	return &Trie{rootHash: t.rootHash, storage: t.storage, needChangelog: t.needChangelog, versioning: t.versioning, maxProofDepth: t.maxProofDepth, serializer: t.serializer}, nil
 }
 
 // CopyTo copy the trie structure into the given storage
 func (t *Trie) CopyTo(storage storage.Storage, needChangelog bool) (*Trie, error) {
-	return &Trie{rootHash: t.rootHash, storage: storage, needChangelog: needChangelog}, nil
+	return &Trie{rootHash: t.rootHash, storage: storage, needChangelog: needChangelog, maxProofDepth: t.maxProofDepth, serializer: t.serializer}, nil
 }
 
 // Replay return roothash not save key to storage
@@ -694,7 +1062,7 @@ func routeToKey(route []byte) []byte {
 }
 
 func emptyBranchNode() *node {
-	empty := &node{Val: [][]byte{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}}
+	empty := &node{Val: make([][]byte, branchWidth)}
 	pb, _ := empty.ToProto()
 	empty.Bytes, _ = proto.Marshal(pb)
 	empty.Hash = hash.Sha3256(empty.Bytes)
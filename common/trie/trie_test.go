@@ -683,3 +683,347 @@ func TestTrie_Iterator(t *testing.T) {
 	it, err = tr.Iterator(HashDomainsPrefix("b"))
 	assert.NotNil(t, err)
 }
+
+func checkTrieStructure(t *testing.T, tr *Trie, rootHash []byte) {
+	n, err := tr.fetchNode(rootHash)
+	assert.Nil(t, err)
+	flag, err := n.Type()
+	assert.Nil(t, err)
+	switch flag {
+	case branch:
+		assert.True(t, lenBranch(n) >= 2, "branch with less than 2 children")
+		for _, child := range n.Val {
+			if len(child) > 0 {
+				checkTrieStructure(t, tr, child)
+			}
+		}
+	case ext:
+		child, err := tr.fetchNode(n.Val[2])
+		assert.Nil(t, err)
+		childFlag, _ := child.Type()
+		assert.Equal(t, branch, childFlag, "ext node must point to a branch")
+		checkTrieStructure(t, tr, n.Val[2])
+	}
+}
+
+func TestTrie_DeleteBatch(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr1, _ := NewTrie(nil, stor, false)
+	tr2, _ := NewTrie(nil, stor, false)
+
+	keys := [][]byte{}
+	for i := 100; i < 400; i++ {
+		key := []byte("abcdeffkey" + strconv.Itoa(i))
+		keys = append(keys, key)
+		tr1.Put(key, key)
+		tr2.Put(key, key)
+	}
+
+	deleted := [][]byte{}
+	for i := 0; i < len(keys); i += 3 {
+		deleted = append(deleted, keys[i])
+		_, err := tr1.Del(keys[i])
+		assert.Nil(t, err)
+	}
+
+	root, err := tr2.DeleteBatch(deleted)
+	assert.Nil(t, err)
+	assert.Equal(t, tr1.RootHash(), root)
+	assert.Equal(t, tr1.RootHash(), tr2.RootHash())
+	checkTrieStructure(t, tr2, root)
+
+	for i, key := range keys {
+		val, err := tr2.Get(key)
+		if i%3 == 0 {
+			assert.NotNil(t, err)
+		} else {
+			assert.Equal(t, key, val)
+		}
+	}
+
+	// a missing key leaves the trie unchanged
+	_, err = tr2.DeleteBatch([][]byte{keys[1], keys[0]})
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, root, tr2.RootHash())
+
+	// delete all
+	_, err = tr2.DeleteBatch(keys[1:2])
+	assert.Nil(t, err)
+	rest := [][]byte{}
+	for i, key := range keys {
+		if i%3 != 0 && i != 1 {
+			rest = append(rest, key)
+		}
+	}
+	root, err = tr2.DeleteBatch(rest)
+	assert.Nil(t, err)
+	assert.Nil(t, root)
+	assert.True(t, tr2.Empty())
+}
+
+func TestTrie_DeleteBatchDuplicateAndMissing(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, true)
+	expected, _ := NewTrie(nil, stor, false)
+	keys := [][]byte{}
+	for i := 100; i < 200; i++ {
+		key := []byte("abcdeffkey" + strconv.Itoa(i))
+		keys = append(keys, key)
+		tr.Put(key, key)
+		expected.Put(key, key)
+	}
+	tr.changelog = nil
+	root := tr.RootHash()
+
+	// missing keys leave the trie unchanged
+	for _, missing := range [][][]byte{
+		{keys[0], []byte("abcdeffkey999")},
+		{[]byte("abcdeffkey")},
+		{append(append([]byte{}, keys[0]...), 'x')},
+		{[]byte("zzzz")},
+	} {
+		_, err := tr.DeleteBatch(missing)
+		assert.Equal(t, ErrNotFound, err)
+		assert.Equal(t, root, tr.RootHash())
+	}
+	empty, _ := NewTrie(nil, stor, false)
+	_, err := empty.DeleteBatch(keys[:1])
+	assert.Equal(t, ErrNotFound, err)
+	root, err = tr.DeleteBatch(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, tr.RootHash(), root)
+
+	// duplicates are deleted once
+	expected.Del(keys[0])
+	expected.Del(keys[5])
+	root, err = tr.DeleteBatch([][]byte{keys[5], keys[0], keys[5], keys[0]})
+	assert.Nil(t, err)
+	assert.Equal(t, expected.RootHash(), root)
+	assert.Equal(t, 2, len(tr.changelog))
+
+	// only the nodes of the new trie are written, no intermediate ones
+	tr.TrackNewNodes()
+	for i := 10; i < 90; i += 2 {
+		expected.Del(keys[i])
+	}
+	batch := [][]byte{}
+	for i := 88; i >= 10; i -= 2 {
+		batch = append(batch, keys[i])
+	}
+	root, err = tr.DeleteBatch(batch)
+	assert.Nil(t, err)
+	assert.Equal(t, expected.RootHash(), root)
+	checkTrieStructure(t, tr, root)
+	_, nodes, _ := tr.CommitWithNodes()
+	assert.NotEmpty(t, nodes)
+	reachable := make(map[string]bool)
+	var walk func(h []byte)
+	walk = func(h []byte) {
+		reachable[string(h)] = true
+		n, err := tr.fetchNode(h)
+		assert.Nil(t, err)
+		children, _ := n.children()
+		for _, child := range children {
+			walk(child)
+		}
+	}
+	walk(root)
+	for h := range nodes {
+		assert.True(t, reachable[h])
+	}
+}
+
+func TestTrie_CommitWithNodes(t *testing.T) {
+	stor1, _ := storage.NewMemoryStorage()
+	tr1, _ := NewTrie(nil, stor1, false)
+	_, _, err := tr1.CommitWithNodes()
+	assert.Equal(t, ErrNodesNotTracked, err)
+
+	tr1.TrackNewNodes()
+	for i := 100; i < 200; i++ {
+		key := []byte("abcdeffkey" + strconv.Itoa(i))
+		tr1.Put(key, key)
+	}
+	root1, nodes1, err := tr1.CommitWithNodes()
+	assert.Nil(t, err)
+	assert.Equal(t, tr1.RootHash(), root1)
+
+	// a peer ingests the new nodes and reaches the same root
+	stor2, _ := storage.NewMemoryStorage()
+	for k, v := range nodes1 {
+		stor2.Put([]byte(k), v)
+	}
+	tr2, err := NewTrie(root1, stor2, false)
+	assert.Nil(t, err)
+	val, err := tr2.Get([]byte("abcdeffkey150"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("abcdeffkey150"), val)
+
+	// only nodes written after the last commit are returned
+	tr1.Put([]byte("abcdeffkey150"), []byte("updated"))
+	root2, nodes2, err := tr1.CommitWithNodes()
+	assert.Nil(t, err)
+	assert.True(t, len(nodes2) < len(nodes1))
+	for k, v := range nodes2 {
+		stor2.Put([]byte(k), v)
+	}
+	tr2, err = NewTrie(root2, stor2, false)
+	assert.Nil(t, err)
+	val, err = tr2.Get([]byte("abcdeffkey150"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("updated"), val)
+
+	// nodes written in a committed transaction are tracked, discarded ones aren't
+	discarded := tr1.Begin()
+	discarded.Put([]byte("abcdeffkey150"), []byte("discarded"))
+	discarded.Discard()
+	tx := tr1.Begin()
+	tx.Put([]byte("abcdeffkey160"), []byte("in tx"))
+	_, err = tx.Commit()
+	assert.Nil(t, err)
+	root3, nodes3, err := tr1.CommitWithNodes()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, nodes3)
+	for k, v := range nodes3 {
+		assert.NotContains(t, string(v), "discarded")
+		stor2.Put([]byte(k), v)
+	}
+	tr2, err = NewTrie(root3, stor2, false)
+	assert.Nil(t, err)
+	val, err = tr2.Get([]byte("abcdeffkey160"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("in tx"), val)
+}
+
+func TestTrie_NodeIntrospection(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+
+	// ext -> branch -> leaf, leaf
+	root := tr.RootHash()
+	flag, err := tr.NodeType(root)
+	assert.Nil(t, err)
+	assert.Equal(t, "ext", flag)
+	children, err := tr.NodeChildren(root)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(children))
+
+	flag, err = tr.NodeType(children[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "branch", flag)
+	children, err = tr.NodeChildren(children[0])
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(children))
+
+	for _, child := range children {
+		flag, err = tr.NodeType(child)
+		assert.Nil(t, err)
+		assert.Equal(t, "leaf", flag)
+		leaves, err := tr.NodeChildren(child)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(leaves))
+	}
+
+	_, err = tr.NodeType([]byte("missing"))
+	assert.NotNil(t, err)
+	_, err = tr.NodeChildren([]byte("missing"))
+	assert.NotNil(t, err)
+}
+
+func TestTrie_GetInto(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+
+	msg := &triepb.Node{Val: [][]byte{[]byte("a"), []byte("b")}}
+	ir, _ := proto.Marshal(msg)
+	tr.Put([]byte("aaaa"), ir)
+	tr.Put([]byte("abbb"), []byte("not a number"))
+	tr.Put([]byte("abcc"), []byte("1024"))
+
+	out := new(triepb.Node)
+	assert.Nil(t, tr.GetProto([]byte("aaaa"), out))
+	assert.Equal(t, msg.Val, out.Val)
+
+	decodeInt := func(data []byte, out interface{}) error {
+		v, err := strconv.Atoi(string(data))
+		if err != nil {
+			return err
+		}
+		*(out.(*int)) = v
+		return nil
+	}
+	var v int
+	assert.Nil(t, tr.GetInto([]byte("abcc"), &v, decodeInt))
+	assert.Equal(t, 1024, v)
+
+	err := tr.GetInto([]byte("abbb"), &v, decodeInt)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrNotFound, err)
+
+	assert.Equal(t, ErrNotFound, tr.GetInto([]byte("abdd"), &v, decodeInt))
+}
+
+func TestTrie_Size(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	size, err := tr.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), size)
+
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	tr.Put([]byte("abbb"), []byte("value2"))
+
+	// ext -> branch -> leaf, leaf
+	expected := int64(0)
+	hashes := [][]byte{tr.RootHash()}
+	for len(hashes) > 0 {
+		ir, err := stor.Get(hashes[0])
+		assert.Nil(t, err)
+		expected += int64(len(ir))
+		children, err := tr.NodeChildren(hashes[0])
+		assert.Nil(t, err)
+		hashes = append(hashes[1:], children...)
+	}
+	size, err = tr.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, size)
+
+	tr.Put([]byte("abcc"), []byte("value3"))
+	grown, err := tr.Size()
+	assert.Nil(t, err)
+	assert.True(t, grown > size)
+
+	tr.Del([]byte("abcc"))
+	size, err = tr.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, size)
+}
+
+func TestTrie_HashOfKey(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	_, err := tr.HashOfKey([]byte("aaaa"))
+	assert.Equal(t, ErrNotFound, err)
+
+	keys := [][]byte{[]byte("aaaa"), []byte("abbb"), []byte("abdd"), []byte("bbbb")}
+	for _, key := range keys {
+		tr.Put(key, key)
+	}
+	hashes := make(map[string]bool)
+	for _, key := range keys {
+		h, err := tr.HashOfKey(key)
+		assert.Nil(t, err)
+		_, levelHashes, err := tr.ProveWithHashes(key)
+		assert.Nil(t, err)
+		assert.Equal(t, levelHashes[len(levelHashes)-1], h)
+		hashes[string(h)] = true
+	}
+	assert.Equal(t, len(keys), len(hashes))
+
+	for _, key := range [][]byte{[]byte("abcc"), []byte("cccc"), []byte("ab")} {
+		_, err := tr.HashOfKey(key)
+		assert.Equal(t, ErrNotFound, err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Errors
+var (
+	ErrTxClosed   = errors.New("trie transaction is already committed or discarded")
+	ErrTxConflict = errors.New("trie root changed since the transaction began")
+)
+
+// Tx is a transaction on the trie, writes are buffered in the transaction
+// and only visible to the base trie after Commit
+type Tx struct {
+	base   *Trie
+	root   []byte
+	work   *Trie
+	closed bool
+}
+
+// Begin start a transaction on the current root of the trie
+func (t *Trie) Begin() *Tx {
+	work := &Trie{
+		rootHash:      t.rootHash,
+		storage:       t.storage,
+		needChangelog: true,
+		maxProofDepth: t.maxProofDepth,
+		serializer:    t.serializer,
+	}
+	// the nodes of the transaction are handed to the base trie on Commit
+	if t.newNodes != nil {
+		work.newNodes = make(map[string][]byte)
+	}
+	return &Tx{base: t, root: t.rootHash, work: work}
+}
+
+// Get the value of the key, uncommitted writes of the transaction are visible
+func (tx *Tx) Get(key []byte) ([]byte, error) {
+	if tx.closed {
+		return nil, ErrTxClosed
+	}
+	return tx.work.Get(key)
+}
+
+// Put the key value in the transaction
+func (tx *Tx) Put(key []byte, val []byte) ([]byte, error) {
+	if tx.closed {
+		return nil, ErrTxClosed
+	}
+	return tx.work.Put(key, val)
+}
+
+// Del the key in the transaction
+func (tx *Tx) Del(key []byte) ([]byte, error) {
+	if tx.closed {
+		return nil, ErrTxClosed
+	}
+	return tx.work.Del(key)
+}
+
+// RootHash return the root hash including the uncommitted writes
+func (tx *Tx) RootHash() []byte {
+	return tx.work.rootHash
+}
+
+// Commit apply the writes of the transaction to the base trie,
+// fail with ErrTxConflict if the base trie has been modified since Begin
+func (tx *Tx) Commit() ([]byte, error) {
+	if tx.closed {
+		return nil, ErrTxClosed
+	}
+	if !bytes.Equal(tx.base.rootHash, tx.root) {
+		return nil, ErrTxConflict
+	}
+	tx.closed = true
+
+	// the keys written in the transaction were last modified at the committed root
+	if tx.base.versioning {
+		keys := make([][]byte, len(tx.work.changelog))
+		for i, entry := range tx.work.changelog {
+			keys[i] = entry.key
+		}
+		if err := tx.base.recordVersion(tx.work.rootHash, keys...); err != nil {
+			return nil, err
+		}
+	}
+	tx.base.rootHash = tx.work.rootHash
+	if tx.base.newNodes != nil {
+		for h, n := range tx.work.newNodes {
+			tx.base.newNodes[h] = n
+		}
+	}
+	if tx.base.needChangelog {
+		tx.base.changelog = append(tx.base.changelog, tx.work.changelog...)
+	}
+	return tx.base.rootHash, nil
+}
+
+// Discard drop the writes of the transaction, the base trie is untouched
+func (tx *Tx) Discard() {
+	tx.closed = true
+}
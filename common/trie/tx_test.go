@@ -0,0 +1,92 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_Tx(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, true)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	root := tr.RootHash()
+
+	tx := tr.Begin()
+	tx.Put([]byte("abbb"), []byte("value2"))
+	tx.Del([]byte("aaaa"))
+
+	// read your writes
+	value, err := tx.Get([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), value)
+	_, err = tx.Get([]byte("aaaa"))
+	assert.NotNil(t, err)
+
+	// the base trie is untouched
+	assert.Equal(t, root, tr.RootHash())
+	value, err = tr.Get([]byte("aaaa"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+	_, err = tr.Get([]byte("abbb"))
+	assert.NotNil(t, err)
+
+	newRoot, err := tx.Commit()
+	assert.Nil(t, err)
+	assert.Equal(t, tx.RootHash(), newRoot)
+	assert.Equal(t, newRoot, tr.RootHash())
+	value, err = tr.Get([]byte("abbb"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), value)
+	assert.Equal(t, 3, len(tr.changelog))
+
+	_, err = tx.Commit()
+	assert.Equal(t, ErrTxClosed, err)
+	_, err = tx.Put([]byte("abcc"), []byte("value3"))
+	assert.Equal(t, ErrTxClosed, err)
+}
+
+func TestTrie_TxDiscard(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	tr.Put([]byte("aaaa"), []byte("value1"))
+	root := tr.RootHash()
+
+	tx := tr.Begin()
+	tx.Put([]byte("aaaa"), []byte("updated"))
+	tx.Discard()
+	assert.Equal(t, root, tr.RootHash())
+	value, err := tr.Get([]byte("aaaa"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+	_, err = tx.Get([]byte("aaaa"))
+	assert.Equal(t, ErrTxClosed, err)
+
+	// a commit after the base trie moved conflicts
+	tx = tr.Begin()
+	tx.Put([]byte("abbb"), []byte("value2"))
+	tr.Put([]byte("abcc"), []byte("value3"))
+	_, err = tx.Commit()
+	assert.Equal(t, ErrTxConflict, err)
+	_, err = tr.Get([]byte("abbb"))
+	assert.NotNil(t, err)
+}
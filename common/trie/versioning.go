@@ -0,0 +1,72 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"errors"
+
+	"github.com/nebulasio/go-nebulas/storage"
+)
+
+// Errors
+var (
+	ErrNotVersioned = errors.New("trie doesn't track the last modified roots, see NewTrieWithVersioning")
+)
+
+// versionPrefix starts the keys of the last modified index in the storage,
+// they can't collide with the node hashes
+var versionPrefix = []byte("trie-lastmod-")
+
+// NewTrieWithVersioning create a trie which records, for every key it puts or deletes,
+// the root hash right after the write, see LastModified. Writes made through a Tx are
+// recorded at the root of its Commit. The index lives in the same storage,
+// one entry per key ever written, taking the key plus 13 bytes of prefix and a 32 bytes root,
+// and is never pruned. Tries over the same storage share the index, so it records the
+// latest write of any of them, whatever root a trie is at.
+func NewTrieWithVersioning(rootHash []byte, storage storage.Storage, needChangelog bool) (*Trie, error) {
+	t, err := NewTrie(rootHash, storage, needChangelog)
+	if err != nil {
+		return nil, err
+	}
+	t.versioning = true
+	return t, nil
+}
+
+// LastModified return the root hash of the trie right after the key was last put or deleted,
+// the root is empty if the delete emptied the trie. ErrNotFound is returned if the key was never
+// written with versioning on.
+func (t *Trie) LastModified(key []byte) ([]byte, error) {
+	if !t.versioning {
+		return nil, ErrNotVersioned
+	}
+	return t.storage.Get(append(append([]byte{}, versionPrefix...), key...))
+}
+
+// recordVersion record root as the last modified root of the keys if versioning is on
+func (t *Trie) recordVersion(root []byte, keys ...[]byte) error {
+	if !t.versioning {
+		return nil
+	}
+	for _, key := range keys {
+		if err := t.storage.Put(append(append([]byte{}, versionPrefix...), key...), root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
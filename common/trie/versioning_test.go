@@ -0,0 +1,99 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_LastModified(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	plain, _ := NewTrie(nil, stor, false)
+	_, err := plain.LastModified([]byte("aaaa"))
+	assert.Equal(t, ErrNotVersioned, err)
+
+	tr, err := NewTrieWithVersioning(nil, stor, false)
+	assert.Nil(t, err)
+	_, err = tr.LastModified([]byte("aaaa"))
+	assert.Equal(t, ErrNotFound, err)
+
+	root1, _ := tr.Put([]byte("aaaa"), []byte("v1"))
+	root2, _ := tr.Put([]byte("bbbb"), []byte("v2"))
+	last, err := tr.LastModified([]byte("aaaa"))
+	assert.Nil(t, err)
+	assert.Equal(t, root1, last)
+	last, _ = tr.LastModified([]byte("bbbb"))
+	assert.Equal(t, root2, last)
+
+	root3, _ := tr.Put([]byte("aaaa"), []byte("v3"))
+	last, _ = tr.LastModified([]byte("aaaa"))
+	assert.Equal(t, root3, last)
+
+	tr.Put([]byte("cccc"), []byte("v4"))
+	tr.Put([]byte("dddd"), []byte("v5"))
+	root4, _ := tr.Del([]byte("bbbb"))
+	last, _ = tr.LastModified([]byte("bbbb"))
+	assert.Equal(t, root4, last)
+	root5, _ := tr.DeleteBatch([][]byte{[]byte("cccc"), []byte("dddd")})
+	for _, key := range []string{"cccc", "dddd"} {
+		last, _ = tr.LastModified([]byte(key))
+		assert.Equal(t, root5, last)
+	}
+	last, _ = tr.LastModified([]byte("aaaa"))
+	assert.Equal(t, root3, last)
+
+	// clones keep versioning, a failed write records nothing
+	clone, _ := tr.Clone()
+	_, err = clone.Del([]byte("eeee"))
+	assert.NotNil(t, err)
+	_, err = clone.LastModified([]byte("eeee"))
+	assert.Equal(t, ErrNotFound, err)
+
+	// the index doesn't affect the trie
+	plain, _ = NewTrie(nil, stor, false)
+	plain.Put([]byte("aaaa"), []byte("v3"))
+	assert.Equal(t, plain.RootHash(), tr.RootHash())
+
+	// spliced keys are recorded too
+	src, _ := NewTrie(nil, stor, false)
+	src.Put([]byte("ffaa"), []byte("v6"))
+	src.Put([]byte("ffbb"), []byte("v7"))
+	assert.Nil(t, tr.CopyFrom(src, []byte("ff")))
+	last, _ = tr.LastModified([]byte("ffbb"))
+	assert.Equal(t, tr.RootHash(), last)
+
+	// transactions record their keys at the committed root, discarded ones record nothing
+	discarded := tr.Begin()
+	discarded.Put([]byte("gggg"), []byte("v8"))
+	discarded.Discard()
+	_, err = tr.LastModified([]byte("gggg"))
+	assert.Equal(t, ErrNotFound, err)
+	tx := tr.Begin()
+	tx.Put([]byte("aaaa"), []byte("v9"))
+	tx.Put([]byte("hhhh"), []byte("v10"))
+	root6, err := tx.Commit()
+	assert.Nil(t, err)
+	for _, key := range []string{"aaaa", "hhhh"} {
+		last, _ = tr.LastModified([]byte(key))
+		assert.Equal(t, root6, last)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"bytes"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+)
+
+// Witness return every node on the paths of the keys, keyed by the node hash, so a trie
+// over a storage seeded with them can Get and Prove the keys offline against the root.
+// The path of a missing key is included as well, it proves the key is absent.
+func (t *Trie) Witness(keys [][]byte) (map[string][]byte, error) {
+	nodes := make(map[string][]byte)
+	for _, key := range keys {
+		c := t.NewCursor(key)
+		for {
+			ok, err := c.Next()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			nodes[string(c.Step().Hash)] = c.Step().Node
+		}
+	}
+	return nodes, nil
+}
+
+// VerifyAgainstStore verify the value of the key in the trie at root using only the nodes in store,
+// keyed by node hash like the result of Witness. Every node is checked against the hash it's
+// reached by. A nil expectedValue verifies the key is absent. ErrIncompleteWitness is returned
+// if a node on the path is missing and ErrProofValueMismatch if the value differs.
+func (t *Trie) VerifyAgainstStore(root, key, expectedValue []byte, store map[string][]byte) error {
+	verifier := &Trie{
+		rootHash:      root,
+		maxProofDepth: t.maxProofDepth,
+		serializer:    t.serializer,
+		storage: &readOnlyStorage{reader: NodeResolver(func(h []byte) ([]byte, error) {
+			if len(h) == 0 {
+				// the empty slot of a branch
+				return nil, ErrNotFound
+			}
+			n, ok := store[string(h)]
+			if !ok {
+				return nil, ErrIncompleteWitness
+			}
+			if !bytes.Equal(hash.Sha3256(n), h) {
+				return nil, ErrProofInvalid
+			}
+			return n, nil
+		})},
+	}
+
+	var value []byte
+	if !verifier.Empty() {
+		var err error
+		value, err = verifier.Get(key)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	if expectedValue == nil {
+		if value != nil {
+			return ErrKeyPresent
+		}
+		return nil
+	}
+	if value == nil || !bytes.Equal(value, expectedValue) {
+		return ErrProofValueMismatch
+	}
+	return nil
+}
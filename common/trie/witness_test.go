@@ -0,0 +1,128 @@
+// Copyright (C) 2017 go-nebulas authors
+//
+// This file is part of the go-nebulas library.
+//
+// the go-nebulas library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// the go-nebulas library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with the go-nebulas library.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package trie
+
+import (
+	"testing"
+
+	"github.com/nebulasio/go-nebulas/crypto/hash"
+	"github.com/nebulasio/go-nebulas/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrie_Witness(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys := make([][]byte, 0)
+	for i := 0; i < 500; i++ {
+		key := hash.Sha3256([]byte{byte(i >> 8), byte(i)})
+		tr.Put(key, []byte{byte(i)})
+		if i%10 == 0 {
+			keys = append(keys, key)
+		}
+	}
+	missing := hash.Sha3256([]byte("missing"))
+
+	witness, err := tr.Witness(append(keys, missing))
+	assert.Nil(t, err)
+
+	// the proofs share their top nodes, the witness holds each node once
+	unique := make(map[string]bool)
+	total := 0
+	for _, key := range keys {
+		_, levelHashes, err := tr.ProveWithHashes(key)
+		assert.Nil(t, err)
+		total += len(levelHashes)
+		for _, h := range levelHashes {
+			unique[string(h)] = true
+			assert.NotNil(t, witness[string(h)])
+		}
+	}
+	assert.True(t, len(witness) < total)
+	assert.True(t, len(witness) >= len(unique))
+	for h, n := range witness {
+		assert.Equal(t, []byte(h), hash.Sha3256(n))
+	}
+
+	// a stateless trie seeded with the witness serves the keys
+	offline, _ := storage.NewMemoryStorage()
+	for h, n := range witness {
+		offline.Put([]byte(h), n)
+	}
+	stateless, err := NewTrie(tr.RootHash(), offline, false)
+	assert.Nil(t, err)
+	for _, key := range keys {
+		value, err := stateless.Get(key)
+		assert.Nil(t, err)
+		want, _ := tr.Get(key)
+		assert.Equal(t, want, value)
+		proof, err := stateless.Prove(key)
+		assert.Nil(t, err)
+		assert.Nil(t, stateless.Verify(tr.RootHash(), key, proof))
+	}
+	_, err = stateless.Get(missing)
+	assert.Equal(t, ErrNotFound, err)
+
+	// a key off the witness can't be served
+	_, err = stateless.Get(hash.Sha3256([]byte{0, 1}))
+	assert.NotNil(t, err)
+
+	empty, _ := NewTrie(nil, stor, false)
+	witness, err = empty.Witness(keys)
+	assert.Nil(t, err)
+	assert.Empty(t, witness)
+}
+
+func TestTrie_VerifyAgainstStore(t *testing.T) {
+	stor, _ := storage.NewMemoryStorage()
+	tr, _ := NewTrie(nil, stor, false)
+	keys := make([][]byte, 0)
+	for i := 0; i < 100; i++ {
+		key := hash.Sha3256([]byte{byte(i)})
+		tr.Put(key, []byte{byte(i)})
+		keys = append(keys, key)
+	}
+	missing := hash.Sha3256([]byte("missing"))
+	witness, err := tr.Witness([][]byte{keys[1], keys[2], missing})
+	assert.Nil(t, err)
+
+	verifier, _ := NewTrie(nil, stor, false)
+	root := tr.RootHash()
+	assert.Nil(t, verifier.VerifyAgainstStore(root, keys[1], []byte{1}, witness))
+	assert.Nil(t, verifier.VerifyAgainstStore(root, keys[2], []byte{2}, witness))
+	assert.Nil(t, verifier.VerifyAgainstStore(root, missing, nil, witness))
+	assert.Equal(t, ErrProofValueMismatch, verifier.VerifyAgainstStore(root, keys[1], []byte{2}, witness))
+	assert.Equal(t, ErrProofValueMismatch, verifier.VerifyAgainstStore(root, missing, []byte{1}, witness))
+	assert.Equal(t, ErrKeyPresent, verifier.VerifyAgainstStore(root, keys[1], nil, witness))
+	assert.Equal(t, ErrIncompleteWitness, verifier.VerifyAgainstStore(root, keys[3], []byte{3}, witness))
+
+	// a node swapped under its hash is caught
+	tampered := make(map[string][]byte, len(witness))
+	for h, n := range witness {
+		tampered[h] = n
+	}
+	leaf, _ := tr.HashOfKey(keys[1])
+	tampered[string(leaf)] = witness[string(root)]
+	assert.Equal(t, ErrProofInvalid, verifier.VerifyAgainstStore(root, keys[1], []byte{1}, tampered))
+
+	// the witness of another root doesn't verify
+	tr.Put(keys[1], []byte("updated"))
+	assert.NotNil(t, verifier.VerifyAgainstStore(tr.RootHash(), keys[1], []byte{1}, witness))
+	assert.Nil(t, verifier.VerifyAgainstStore(nil, keys[1], nil, nil))
+}